@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/mp3"
+	"github.com/gopxl/beep/v2/vorbis"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+// decoder decodes one file format. Formats are recognized by the first bytes of a file, the
+// extensions are only a fallback for files whose content is not recognized.
+type decoder struct {
+	name       string
+	extensions []string
+	sniff      func(head []byte) bool
+	decode     func(r io.ReadSeekCloser) (beep.StreamSeeker, beep.Format, error)
+}
+
+// sniffLen is the number of bytes read from the start of a file for sniffing.
+const sniffLen = 16
+
+var decoders []*decoder
+
+// registerDecoder adds a decoder to the supported formats. Decoders register themselves from
+// init functions; content is sniffed in registration order.
+func registerDecoder(d *decoder) {
+	decoders = append(decoders, d)
+}
+
+// detectDecoder finds the decoder for a file from its first bytes, or from its extension,
+// ignoring case, when the content is not recognized.
+func detectDecoder(file string, head []byte) (*decoder, error) {
+	for _, d := range decoders {
+		if d.sniff != nil && d.sniff(head) {
+			return d, nil
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, d := range decoders {
+		if ext != "" && slices.Contains(d.extensions, ext) {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported file format: %s", file)
+}
+
+// readHead reads the first bytes of the audio in f for sniffing and returns where the audio
+// starts. That is after the ID3v2 tag that is often put in front of FLAC and WAV files as well as
+// MP3s, or at 0 without one. f is left at the start of the audio.
+func readHead(f *os.File) (head []byte, start int64, err error) {
+	head, err = readAt(f, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if start = id3TagLen(head); start > 0 {
+		if head, err = readAt(f, start); err != nil {
+			return nil, 0, err
+		}
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	return head, start, nil
+}
+
+// readAt reads up to sniffLen bytes of f at offset.
+func readAt(f *os.File, offset int64) ([]byte, error) {
+	head := make([]byte, sniffLen)
+	n, err := f.ReadAt(head, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// id3TagLen returns the length of the ID3v2 tag head starts with, footer included, or 0.
+func id3TagLen(head []byte) int64 {
+	if len(head) < 10 || string(head[:3]) != "ID3" || head[3] == 0xff || head[4] == 0xff {
+		return 0
+	}
+	for _, b := range head[6:10] {
+		if b&0x80 != 0 {
+			return 0
+		}
+	}
+	n := int64(10 + syncsafe(head[6:10]))
+	if head[5]&0x10 != 0 {
+		n += 10
+	}
+	return n
+}
+
+// taggedFile reads a file from the end of its ID3v2 tag on, so decoders see the audio at offset 0.
+type taggedFile struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (t *taggedFile) Close() error {
+	return t.f.Close()
+}
+
+// audioFrom returns f for decoding the audio that starts at start.
+func audioFrom(f *os.File, start int64) (io.ReadSeekCloser, error) {
+	if start == 0 {
+		return f, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &taggedFile{SectionReader: io.NewSectionReader(f, start, info.Size()-start), f: f}, nil
+}
+
+// decoderFor returns the decoder of a file without decoding it.
+func decoderFor(file string) (*decoder, error) {
+	f, err := openFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head, _, err := readHead(f)
+	if err != nil {
+		return nil, err
+	}
+	return detectDecoder(file, head)
+}
+
+// isFormat reports whether file is decoded by the decoder with the given name.
+func isFormat(file, name string) bool {
+	d, err := decoderFor(file)
+	return err == nil && d.name == name
+}
+
+// isMPEGFrame reports whether head starts with an MPEG audio frame header. An ID3v2 tag in
+// front of it has been skipped by readHead.
+func isMPEGFrame(head []byte) bool {
+	// frame sync, a valid version and a layer other than reserved
+	return len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0 && head[1]&0x18 != 0x08 && head[1]&0x06 != 0
+}
+
+func init() {
+	registerDecoder(&decoder{
+		name:       "wav",
+		extensions: []string{".wav", ".wave"},
+		sniff: func(head []byte) bool {
+			return len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE"
+		},
+		decode: func(r io.ReadSeekCloser) (beep.StreamSeeker, beep.Format, error) {
+			return wav.Decode(r)
+		},
+	})
+	registerDecoder(&decoder{
+		name:       "flac",
+		extensions: []string{".flac"},
+		sniff: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte("fLaC"))
+		},
+		decode: func(r io.ReadSeekCloser) (beep.StreamSeeker, beep.Format, error) {
+			return flac.Decode(r)
+		},
+	})
+	registerDecoder(&decoder{
+		name:       "ogg",
+		extensions: []string{".ogg", ".oga"},
+		sniff: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte("OggS"))
+		},
+		decode: func(r io.ReadSeekCloser) (beep.StreamSeeker, beep.Format, error) {
+			return vorbis.Decode(r)
+		},
+	})
+	registerDecoder(&decoder{
+		name:       "midi",
+		extensions: []string{".mid", ".midi"},
+		sniff: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte("MThd"))
+		},
+		decode: func(r io.ReadSeekCloser) (beep.StreamSeeker, beep.Format, error) {
+			return decodeMIDI(r, 0)
+		},
+	})
+	// last, as a bare frame sync is the weakest signature
+	registerDecoder(&decoder{
+		name:       "mp3",
+		extensions: []string{".mp3"},
+		sniff:      isMPEGFrame,
+		decode: func(r io.ReadSeekCloser) (beep.StreamSeeker, beep.Format, error) {
+			return mp3.Decode(r)
+		},
+	})
+}
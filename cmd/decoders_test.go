@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	wavHead  = []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+	flacHead = []byte("fLaC\x00\x00\x00\x22")
+	oggHead  = []byte("OggS\x00\x02")
+	midiHead = []byte("MThd\x00\x00\x00\x06")
+	mp3Head  = []byte{0xff, 0xfb, 0x90, 0x64}
+)
+
+func TestDetectDecoder(t *testing.T) {
+	tests := []struct {
+		file string
+		head []byte
+		want string // empty for an error
+	}{
+		{"a.wav", wavHead, "wav"},
+		{"a.mp3", wavHead, "wav"},
+		{"noext", flacHead, "flac"},
+		{"a.oga", oggHead, "ogg"},
+		{"a.bin", midiHead, "midi"},
+		{"a.flac", mp3Head, "mp3"},
+		{"a.mp3", []byte{0xff, 0x00}, "mp3"},
+		{"A.WAVE", nil, "wav"},
+		{"a.MID", []byte("junk"), "midi"},
+		{"a.txt", []byte("junk"), ""},
+		{"noext", nil, ""},
+	}
+	for _, tt := range tests {
+		d, err := detectDecoder(tt.file, tt.head)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("detectDecoder(%q) = %s, want an error", tt.file, d.name)
+		case tt.want != "" && err != nil:
+			t.Errorf("detectDecoder(%q): %s", tt.file, err)
+		case tt.want != "" && d.name != tt.want:
+			t.Errorf("detectDecoder(%q) = %s, want %s", tt.file, d.name, tt.want)
+		}
+	}
+}
+
+func TestReadHeadSkipsID3(t *testing.T) {
+	tag := id3v23(map[string][]byte{"TIT2": []byte("\x00Song")})
+	tag = tag[:len(tag):len(tag)] // every case appends to its own copy
+	tests := []struct {
+		name  string
+		data  []byte
+		want  string
+		start int64
+	}{
+		{"flac after a tag", append(tag, flacHead...), "flac", int64(len(tag))},
+		{"wav after a tag", append(tag, wavHead...), "wav", int64(len(tag))},
+		{"mp3 after a tag", append(tag, mp3Head...), "mp3", int64(len(tag))},
+		{"untagged", flacHead, "flac", 0},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, "audio")
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		head, start, err := readHead(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if start != tt.start {
+			t.Errorf("%s: audio starts at %d, want %d", tt.name, start, tt.start)
+		}
+		d, err := detectDecoder(path, head)
+		if err != nil || d.name != tt.want {
+			t.Errorf("%s: detected %v, %v; want %s", tt.name, d, err, tt.want)
+		}
+	}
+}
+
+func TestIsSupportedFileSniffs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"take1":     wavHead,
+		"cover.jpg": {0xff, 0xd8, 0xff, 0xe0},
+		"notes.txt": []byte("hello"),
+		"empty.mp3": nil,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := expandPath(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "empty.mp3"), filepath.Join(dir, "take1")}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expandPath = %q, want %q", got, want)
+	}
+}
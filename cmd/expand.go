@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// isSupportedFile reports whether load can decode file, going by its content like load does, or
+// by its extension when the content is not recognized. Directories and patterns are expanded to
+// the supported files.
+func isSupportedFile(file string) bool {
+	_, err := decoderFor(file)
+	return err == nil
+}
+
+// isPattern reports whether path contains glob wildcards.
+func isPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// expandHome replaces a leading ~ with the home directory. The shell does this for arguments on
+// the command line, but not for commands typed into gordon itself.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// expandPath returns path itself for a file. A directory expands to the supported files in it,
+// and with recursive in its subdirectories too; a pattern like "**/*.flac" expands to the
+// supported files it matches, where ** matches any number of directories. Only paths that do not
+// exist are taken as patterns, so names like "Album [FLAC]" work as they are. Expanded files are
+// sorted by sortExpanded.
+func expandPath(path string, recursive bool) ([]string, error) {
+	path = expandHome(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) || !isPattern(path) {
+			return nil, err
+		}
+		files, err := globFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no supported files match %s", path)
+		}
+		sortExpanded(files)
+		return files, nil
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSupportedFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 && !recursive {
+		return nil, fmt.Errorf("no supported files in %s, add --recursive to search its subdirectories", path)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no supported files in %s", path)
+	}
+	sortExpanded(files)
+	return files, nil
+}
+
+// globFiles returns the supported files matching pattern. The directories before the first
+// wildcard are walked; ** matches any number of directories below them.
+func globFiles(pattern string) ([]string, error) {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	first := slices.IndexFunc(parts, isPattern)
+	base := strings.Join(parts[:first], "/")
+	if base == "" {
+		base = "."
+		if first > 0 {
+			base = "/"
+		}
+	}
+	for _, part := range parts[first:] {
+		if _, err := filepath.Match(part, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+	}
+	rest := parts[first:]
+	deep := slices.Contains(rest, "**")
+	var files []string
+	err := filepath.WalkDir(filepath.FromSlash(base), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == filepath.FromSlash(base) {
+				return err
+			}
+			// unreadable directories further down are left out
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(base), p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if !deep && len(segments) >= len(rest) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSupportedFile(p) && matchSegments(rest, segments) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// matchSegments matches path segments against pattern segments, where ** matches zero or more
+// segments and every other pattern segment one segment as in filepath.Match.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		return matchSegments(pattern[1:], segments) || (len(segments) > 0 && matchSegments(pattern, segments[1:]))
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
+
+// sortExpanded orders files directory by directory. Within a directory the files are ordered by
+// their track number tags if all of them have one, otherwise naturally by name so that
+// "2 Intro.mp3" comes before "10 Outro.mp3".
+func sortExpanded(files []string) {
+	tracks := make(map[string]int, len(files))
+	tagged := map[string]bool{}
+	for _, file := range files {
+		n := trackNumber(file)
+		tracks[file] = n
+		dir := filepath.Dir(file)
+		if all, seen := tagged[dir]; !seen || all {
+			tagged[dir] = n > 0
+		}
+	}
+	slices.SortStableFunc(files, func(a, b string) int {
+		dirA, dirB := filepath.Dir(a), filepath.Dir(b)
+		if dirA != dirB {
+			return naturalCompare(dirA, dirB)
+		}
+		if tagged[dirA] && tracks[a] != tracks[b] {
+			return tracks[a] - tracks[b]
+		}
+		return naturalCompare(filepath.Base(a), filepath.Base(b))
+	})
+}
+
+// naturalCompare compares strings case-insensitively, with runs of digits compared by their value.
+func naturalCompare(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			startA, startB := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			numA := strings.TrimLeft(a[startA:i], "0")
+			numB := strings.TrimLeft(b[startB:j], "0")
+			if len(numA) != len(numB) {
+				return len(numA) - len(numB)
+			}
+			if c := strings.Compare(numA, numB); c != 0 {
+				return c
+			}
+			continue
+		}
+		ca, cb := lower(a[i]), lower(b[j])
+		if ca != cb {
+			return int(ca) - int(cb)
+		}
+		i++
+		j++
+	}
+	if c := (len(a) - i) - (len(b) - j); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
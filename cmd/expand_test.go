@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.flac", "a.flac", true},
+		{"*.flac", "sub/a.flac", false},
+		{"**/*.flac", "a.flac", true},
+		{"**/*.flac", "x/y/a.flac", true},
+		{"**/*.flac", "x/y/a.mp3", false},
+		{"*/cd?/*", "album/cd1/01.mp3", true},
+		{"*/cd?/*", "album/cd10/01.mp3", false},
+		{"a/**/b/*.ogg", "a/b/1.ogg", true},
+		{"a/**/b/*.ogg", "a/x/y/b/1.ogg", true},
+		{"a/**/b/*.ogg", "a/x/y/c/1.ogg", false},
+		{"**", "any/depth/file.wav", true},
+	}
+	for _, tt := range tests {
+		got := matchSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.path, "/"))
+		if got != tt.want {
+			t.Errorf("matchSegments(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int // sign of the result
+	}{
+		{"2 Intro.mp3", "10 Outro.mp3", -1},
+		{"track10.flac", "Track2.flac", 1},
+		{"a.mp3", "A.mp3", 1},
+		{"a.mp3", "a.mp3", 0},
+		{"01.mp3", "1.mp3", -1},
+		{"disc1/9.mp3", "disc1/10.mp3", -1},
+		{"abc", "ab", 1},
+	}
+	for _, tt := range tests {
+		got := naturalCompare(tt.a, tt.b)
+		if sign(got) != tt.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want sign %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestExpandPath(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"Album [FLAC]/10 Outro.flac",
+		"Album [FLAC]/2 Intro.flac",
+		"Album [FLAC]/cover.jpg",
+		"Album [FLAC]/CD2/1 Bonus.flac",
+		"Song [Live].mp3",
+		"other/take.WAV",
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path      string
+		recursive bool
+		want      []string
+	}{
+		{"Album [FLAC]", false, []string{"Album [FLAC]/2 Intro.flac", "Album [FLAC]/10 Outro.flac"}},
+		{"Album [FLAC]", true, []string{"Album [FLAC]/2 Intro.flac", "Album [FLAC]/10 Outro.flac", "Album [FLAC]/CD2/1 Bonus.flac"}},
+		{"Song [Live].mp3", false, []string{"Song [Live].mp3"}},
+		{"**/*.flac", false, []string{"Album [FLAC]/2 Intro.flac", "Album [FLAC]/10 Outro.flac", "Album [FLAC]/CD2/1 Bonus.flac"}},
+		{"*/*.wav", false, nil},
+		{"*/*.WAV", false, []string{"other/take.WAV"}},
+	}
+	for _, tt := range tests {
+		got, err := expandPath(filepath.Join(dir, tt.path), tt.recursive)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("expandPath(%q) = %v, want an error", tt.path, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expandPath(%q): %s", tt.path, err)
+			continue
+		}
+		for i := range got {
+			got[i], _ = filepath.Rel(dir, got[i])
+			got[i] = filepath.ToSlash(got[i])
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("expandPath(%q, %v) = %q, want %q", tt.path, tt.recursive, got, tt.want)
+		}
+	}
+}
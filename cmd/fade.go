@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/spf13/cobra"
+)
+
+// FadeCurve selects how a fade moves between silence and full level.
+type FadeCurve int
+
+const (
+	FadeLinear FadeCurve = iota
+	FadeExponential
+	FadeEqualPower
+)
+
+func (c FadeCurve) String() string {
+	switch c {
+	case FadeExponential:
+		return "exponential"
+	case FadeEqualPower:
+		return "equal-power"
+	}
+	return "linear"
+}
+
+func parseFadeCurve(name string) (FadeCurve, error) {
+	switch strings.ToLower(name) {
+	case "", "linear", "lin":
+		return FadeLinear, nil
+	case "exponential", "exp":
+		return FadeExponential, nil
+	case "equal-power", "equalpower", "power", "eq":
+		return FadeEqualPower, nil
+	}
+	return FadeLinear, fmt.Errorf("unknown fade curve %q (use linear, exponential or equal-power)", name)
+}
+
+// gain maps fade progress x in [0, 1] (0 silent, 1 full level) to a linear gain.
+func (c FadeCurve) gain(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	switch c {
+	case FadeExponential:
+		// 60 dB of range, shifted so the curve still starts at true silence.
+		return (math.Pow(10, 3*x) - 1) / (1000 - 1)
+	case FadeEqualPower:
+		return math.Sin(x * math.Pi / 2)
+	}
+	return x
+}
+
+// Fader applies a fade-in at the start and a fade-out at the end of the wrapped StreamSeeker.
+//
+// The gain of every sample is derived from its position in the stream rather than from how many
+// samples have been played, so seeking into or out of a fade is always correct. FadeIn and FadeOut
+// are wall-clock durations: the number of source samples they span is scaled by the playback speed.
+type Fader struct {
+	Streamer   beep.StreamSeeker
+	SampleRate beep.SampleRate
+	FadeIn     time.Duration
+	FadeOut    time.Duration
+	Curve      FadeCurve
+	speed      float64
+}
+
+func NewFader(s beep.StreamSeeker, sampleRate beep.SampleRate) *Fader {
+	return &Fader{
+		Streamer:   s,
+		SampleRate: sampleRate,
+		speed:      1,
+	}
+}
+
+// SetSpeed tells the fader how fast its source is consumed relative to real time.
+func (f *Fader) SetSpeed(speed float64) {
+	if speed <= 0 {
+		speed = 1
+	}
+	f.speed = speed
+}
+
+func (f *Fader) fadeSamples(d time.Duration) int {
+	return int(float64(f.SampleRate.N(d)) * f.speed)
+}
+
+func (f *Fader) gainAt(pos int) float64 {
+	g := 1.0
+	if in := f.fadeSamples(f.FadeIn); in > 0 && pos < in {
+		g *= f.Curve.gain(float64(pos) / float64(in))
+	}
+	if out := f.fadeSamples(f.FadeOut); out > 0 {
+		if remaining := f.Streamer.Len() - pos; remaining < out {
+			g *= f.Curve.gain(float64(remaining) / float64(out))
+		}
+	}
+	return g
+}
+
+func (f *Fader) Stream(samples [][2]float64) (n int, ok bool) {
+	pos := f.Streamer.Position()
+	n, ok = f.Streamer.Stream(samples)
+	if f.FadeIn <= 0 && f.FadeOut <= 0 {
+		return n, ok
+	}
+	for i := range samples[:n] {
+		g := f.gainAt(pos + i)
+		samples[i][0] *= g
+		samples[i][1] *= g
+	}
+	return n, ok
+}
+
+func (f *Fader) Err() error {
+	return f.Streamer.Err()
+}
+
+func (f *Fader) Len() int {
+	return f.Streamer.Len()
+}
+
+func (f *Fader) Position() int {
+	return f.Streamer.Position()
+}
+
+func (f *Fader) Seek(p int) error {
+	return f.Streamer.Seek(p)
+}
+
+// parseSeconds accepts either plain seconds ("1.5") or a Go duration ("1500ms").
+func parseSeconds(arg string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(arg, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return time.ParseDuration(arg)
+}
+
+var fadeCmd = &cobra.Command{
+	Use:   "fade [track number] [fade-in] [fade-out] [curve]",
+	Short: "Set fade-in/fade-out durations (seconds or e.g. 1.5s) and curve (linear, exponential, equal-power) of a track",
+	Args:  cobra.RangeArgs(3, 4),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := requireTrack(args[0])
+		if t == nil {
+			return
+		}
+		if t.Fader == nil {
+			fmt.Printf("Track %d does not support fades\n", t.TrackNumber)
+			return
+		}
+		fadeIn, err := parseSeconds(args[1])
+		if err != nil {
+			fmt.Printf("Failed to parse fade-in: %s\n", err)
+			return
+		}
+		fadeOut, err := parseSeconds(args[2])
+		if err != nil {
+			fmt.Printf("Failed to parse fade-out: %s\n", err)
+			return
+		}
+		curve := t.Fader.Curve
+		if len(args) > 3 {
+			curve, err = parseFadeCurve(args[3])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		output.Lock()
+		t.Fader.FadeIn = fadeIn
+		t.Fader.FadeOut = fadeOut
+		t.Fader.Curve = curve
+		mixChanged()
+		output.Unlock()
+		fmt.Printf("Track %d fades set to in %v, out %v (%s)\n", t.TrackNumber, fadeIn, fadeOut, curve)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(fadeCmd)
+}
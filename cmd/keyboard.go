@@ -6,21 +6,57 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/chzyer/readline"
 	"github.com/eiannone/keyboard"
 	// "github.com/gopxl/beep/speaker"
 	"github.com/spf13/cobra"
 )
 
 // commandMode prompts the user for a full command input similar to vim's command mode.
+// It shares history and completion with the shell.
 func commandMode() {
-	// enter repl loop
-	rl, _ := readline.New("> ")
+	rl, err := newLineReader()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	defer rl.Close()
 	input, _ := rl.Readline()
-	args := strings.Fields(input)
-	RootCmd.SetArgs(args)
-	RootCmd.Execute()
+	runLine(input)
+}
+
+// splitArgs splits a command line on whitespace, keeping single- or double-quoted
+// strings together so labels like "verse 2" survive as one argument.
+func splitArgs(line string) []string {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
 }
 
 // ControlLoop starts in normal mode where keys control media playback.
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// cueFramesPerSecond is the resolution of CUE sheet timestamps (mm:ss:ff).
+const cueFramesPerSecond = 75
+
+// labelEntry is a marker as found in a label track or CUE sheet, in seconds.
+type labelEntry struct {
+	Start float64
+	End   float64
+	Label string
+}
+
+func isCueSheet(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".cue")
+}
+
+// readAudacityLabels parses an Audacity label track export: one "start\tend\tlabel" line per
+// label. Spectral selection lines (starting with a backslash) are skipped.
+func readAudacityLabels(r io.Reader) ([]labelEntry, error) {
+	var entries []labelEntry
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "\\") {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected start<TAB>end<TAB>label", line)
+		}
+		start, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start: %w", line, err)
+		}
+		end, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid end: %w", line, err)
+		}
+		entry := labelEntry{Start: start, End: end}
+		if len(fields) == 3 {
+			entry.Label = fields[2]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func writeAudacityLabels(w io.Writer, entries []labelEntry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%.6f\t%.6f\t%s\n", e.Start, e.End, e.Label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseCueTime parses a CUE mm:ss:ff timestamp into seconds.
+func parseCueTime(s string) (float64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid CUE time %q", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid CUE time %q", s)
+		}
+		v[i] = n
+	}
+	return float64(v[0]*60+v[1]) + float64(v[2])/cueFramesPerSecond, nil
+}
+
+func formatCueTime(seconds float64) string {
+	frames := int(seconds*cueFramesPerSecond + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d", frames/(60*cueFramesPerSecond), frames/cueFramesPerSecond%60, frames%cueFramesPerSecond)
+}
+
+// cueField returns the rest of a CUE line after its keyword, without surrounding quotes.
+func cueField(line, keyword string) string {
+	return strings.Trim(strings.TrimSpace(line[len(keyword):]), `"`)
+}
+
+// readCueSheet turns the INDEX 01 entry of every TRACK into a point label, named after the
+// track TITLE. Times are taken as relative to the loaded session. The files named by FILE
+// entries are returned too; the times of a sheet that names several restart with each file.
+func readCueSheet(r io.Reader) (entries []labelEntry, files []string, err error) {
+	current := -1
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(upper, "FILE "):
+			name := cueField(line, "FILE")
+			// the file type follows the name
+			if i := strings.LastIndex(name, `"`); i >= 0 {
+				name = name[:i]
+			} else if fields := strings.Fields(name); len(fields) > 1 {
+				name = strings.Join(fields[:len(fields)-1], " ")
+			}
+			files = append(files, name)
+		case strings.HasPrefix(upper, "TRACK "):
+			entries = append(entries, labelEntry{Start: -1, Label: "Track " + strings.Fields(line)[1]})
+			current = len(entries) - 1
+		case strings.HasPrefix(upper, "TITLE ") && current >= 0:
+			entries[current].Label = cueField(line, "TITLE")
+		case strings.HasPrefix(upper, "INDEX ") && current >= 0:
+			fields := strings.Fields(line)
+			if len(fields) != 3 || fields[1] != "01" {
+				continue
+			}
+			start, err := parseCueTime(fields[2])
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[current].Start = start
+			entries[current].End = start
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	valid := entries[:0]
+	for _, e := range entries {
+		if e.Start >= 0 {
+			valid = append(valid, e)
+		}
+	}
+	return valid, files, nil
+}
+
+func writeCueSheet(w io.Writer, audioFile string, entries []labelEntry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "FILE %q WAVE\n", filepath.Base(audioFile))
+	for i, e := range entries {
+		fmt.Fprintf(bw, "  TRACK %02d AUDIO\n", i+1)
+		if e.Label != "" {
+			fmt.Fprintf(bw, "    TITLE %q\n", e.Label)
+		}
+		fmt.Fprintf(bw, "    INDEX 01 %s\n", formatCueTime(e.Start))
+	}
+	return bw.Flush()
+}
+
+// importLabels adds the entries as markers, updating markers that already carry the same label.
+// Entries with an end after their start become region markers. It returns the number imported.
+func importLabels(entries []labelEntry) int {
+	length := ap.streamer.Len()
+	imported := 0
+	for _, e := range entries {
+		start := ap.sampleRate.N(time.Duration(e.Start * float64(time.Second)))
+		if start < 0 || start >= length {
+			fmt.Printf("Skipping label %q at %.3f sec: outside of the loaded audio\n", e.Label, e.Start)
+			continue
+		}
+		// numeric labels are common in label tracks; they are labels, not marker indices
+		index := -1
+		if e.Label != "" {
+			index = markerByLabel(e.Label)
+		}
+		if index < 0 {
+			index = freeMarkerIndex()
+		}
+		for len(Markers) <= index {
+			Markers = append(Markers, PlaybackPosition{})
+		}
+		m := newMarker(start, e.Label)
+		if e.End > e.Start {
+			m.EndPosition = min(ap.sampleRate.N(time.Duration(e.End*float64(time.Second))), length)
+		}
+		Markers[index] = m
+		imported++
+	}
+	return imported
+}
+
+// exportLabels returns the set markers sorted by position.
+func exportLabels() []labelEntry {
+	var entries []labelEntry
+	for _, m := range Markers {
+		if !m.Set {
+			continue
+		}
+		e := labelEntry{Start: m.PlayPosition, End: m.PlayPosition, Label: m.Label}
+		if m.IsRegion() {
+			e.End = ap.sampleRate.D(m.EndPosition).Seconds()
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Start < entries[j].Start })
+	return entries
+}
+
+var markersImportCmd = &cobra.Command{
+	Use:               "import [file]",
+	Short:             "Import markers from an Audacity label track (.txt) or a CUE sheet (.cue)",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFiles,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireAudioLoaded() {
+			return
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("Failed to open label file: %s\n", err)
+			return
+		}
+		defer f.Close()
+		var entries []labelEntry
+		if isCueSheet(args[0]) {
+			var files []string
+			entries, files, err = readCueSheet(f)
+			if len(files) > 1 {
+				fmt.Printf("Warning: %s names %d files; their times restart with each file but are all imported as times of the loaded session\n", args[0], len(files))
+			}
+		} else {
+			entries, err = readAudacityLabels(f)
+		}
+		if err != nil {
+			fmt.Printf("Failed to parse %s: %s\n", args[0], err)
+			return
+		}
+		n := importLabels(entries)
+		saveMarkerSidecar()
+		fmt.Printf("Imported %d markers from %s\n", n, args[0])
+	},
+}
+
+var markersExportCmd = &cobra.Command{
+	Use:               "export [file]",
+	Short:             "Export markers as an Audacity label track (.txt) or a CUE sheet (.cue)",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFiles,
+	Run: func(cmd *cobra.Command, args []string) {
+		mts := requireMultiTrack()
+		if mts == nil {
+			return
+		}
+		entries := exportLabels()
+		f, err := os.Create(args[0])
+		if err != nil {
+			fmt.Printf("Failed to create label file: %s\n", err)
+			return
+		}
+		defer f.Close()
+		if isCueSheet(args[0]) {
+			audioFile := ""
+			if len(mts.Tracks) > 0 {
+				audioFile = mts.Tracks[0].TrackName
+			}
+			err = writeCueSheet(f, audioFile, entries)
+		} else {
+			err = writeAudacityLabels(f, entries)
+		}
+		if err != nil {
+			fmt.Printf("Failed to write %s: %s\n", args[0], err)
+			return
+		}
+		fmt.Printf("Exported %d markers to %s\n", len(entries), args[0])
+	},
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCueTime(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want float64
+		err  bool
+	}{
+		{"00:00:00", 0, false},
+		{"01:02:00", 62, false},
+		{"03:10:37", 190 + 37.0/75, false},
+		{"74:59:74", 74*60 + 59 + 74.0/75, false},
+		{"01:02", 0, true},
+		{"01:02:03:04", 0, true},
+		{"aa:00:00", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCueTime(tt.arg)
+		if (err != nil) != tt.err || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseCueTime(%q) = %v, %v; want %v, error %v", tt.arg, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestReadCueSheet(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet string
+		want  []labelEntry
+		files []string
+		err   bool
+	}{
+		{
+			name: "titles and indexes",
+			sheet: `REM GENRE Rock
+PERFORMER "Band"
+FILE "album.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "Intro"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Verse and Chorus"
+    INDEX 00 03:58:00
+    INDEX 01 04:00:15
+  TRACK 03 AUDIO
+    INDEX 01 07:30:00
+`,
+			want: []labelEntry{
+				{Start: 0, End: 0, Label: "Intro"},
+				{Start: 240.2, End: 240.2, Label: "Verse and Chorus"},
+				{Start: 450, End: 450, Label: "Track 03"},
+			},
+			files: []string{"album.wav"},
+		},
+		{
+			name:  "lower case keywords, track without an index",
+			sheet: "file \"a.wav\" wave\ntrack 01 audio\ntitle \"Gone\"\ntrack 02 audio\nindex 01 00:10:00\n",
+			want:  []labelEntry{{Start: 10, End: 10, Label: "Track 02"}},
+			files: []string{"a.wav"},
+		},
+		{
+			name:  "one file per track",
+			sheet: "FILE \"Side A.flac\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\nFILE side-b.flac WAVE\nTRACK 02 AUDIO\nINDEX 01 00:00:00\n",
+			want:  []labelEntry{{Start: 0, End: 0, Label: "Track 01"}, {Start: 0, End: 0, Label: "Track 02"}},
+			files: []string{"Side A.flac", "side-b.flac"},
+		},
+		{
+			name:  "broken time",
+			sheet: "TRACK 01 AUDIO\nINDEX 01 00:xx:00\n",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		got, files, err := readCueSheet(strings.NewReader(tt.sheet))
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if !slices.Equal(files, tt.files) {
+			t.Errorf("%s: files %q, want %q", tt.name, files, tt.files)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !sameEntry(got[i], tt.want[i]) {
+				t.Errorf("%s: entry %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCueSheetRoundTrip(t *testing.T) {
+	entries := []labelEntry{{Start: 0, End: 0, Label: "Intro"}, {Start: 61.2, End: 61.2, Label: "Verse"}}
+	var buf bytes.Buffer
+	if err := writeCueSheet(&buf, "/music/take.wav", entries); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := readCueSheet(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) || !sameEntry(got[0], entries[0]) || !sameEntry(got[1], entries[1]) {
+		t.Errorf("round trip = %+v, want %+v", got, entries)
+	}
+}
+
+func TestImportNumericLabels(t *testing.T) {
+	newTestSession(t, 10)
+	Markers[1] = newMarker(1000, "intro")
+	Markers[2] = newMarker(2000, "verse")
+	n := importLabels([]labelEntry{
+		{Start: 5, End: 5, Label: "1"},
+		{Start: 6, End: 6, Label: "2"},
+		{Start: 1.5, End: 1.5, Label: "intro"},
+	})
+	if n != 3 {
+		t.Fatalf("imported %d labels, want 3", n)
+	}
+	if Markers[1].Label != "intro" || Markers[1].SamplePosition != 1500 {
+		t.Errorf("marker 1 is %q at %d, want intro moved to 1500", Markers[1].Label, Markers[1].SamplePosition)
+	}
+	if Markers[2].Label != "verse" || Markers[2].SamplePosition != 2000 {
+		t.Errorf("marker 2 is %q at %d, want verse left at 2000", Markers[2].Label, Markers[2].SamplePosition)
+	}
+	if i := markerByLabel("1"); i < 0 || Markers[i].SamplePosition != 5000 {
+		t.Errorf("label \"1\" imported as marker %d, want a free marker at 5000", i)
+	}
+}
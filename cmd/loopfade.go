@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"github.com/gopxl/beep/v2"
+)
+
+// crossfadeLen returns the crossfade length, limited to half of the loop. Plain playback with
+// a queue entry lined up crossfades into that entry instead, over its read-ahead head.
+func (l *loopBetween) crossfadeLen() int {
+	if l.queued() {
+		return min(len(l.nextHead), l.end/2)
+	}
+	if l.xfade <= 0 || l.end <= l.start {
+		return 0
+	}
+	return min(l.xfade, (l.end-l.start)/2)
+}
+
+// headStale reports whether the head has to be read again for a crossfade of n samples: it is
+// kept from pass to pass until the loop start, the crossfade or, through mixChanged, the mix
+// changes.
+func (l *loopBetween) headStale(n int) bool {
+	at := l.start
+	if l.queued() {
+		at = -1
+	}
+	return len(l.head) != n || l.headAt != at
+}
+
+// readHead reads the first n samples after the loop start and seeks back to resume.
+func (l *loopBetween) readHead(n, resume int) {
+	if l.queued() {
+		l.head = l.nextHead[:n]
+		l.headAt = -1
+		return
+	}
+	l.head = l.head[:0]
+	l.headAt = l.start
+	if err := l.s.Seek(l.start); err != nil {
+		return
+	}
+	head := make([][2]float64, n)
+	read := 0
+	for read < n {
+		sn, ok := l.s.Stream(head[read:])
+		read += sn
+		if !ok {
+			break
+		}
+	}
+	if err := l.s.Seek(resume); err != nil || read < n {
+		return
+	}
+	l.head = head
+}
+
+// mixChanged drops the crossfade head of the loop so the next pass reads it with the changed
+// mix. It must be called with the output locked after anything that changes what the session
+// sounds like.
+func mixChanged() {
+	if ap != nil {
+		ap.loop.head = nil
+	}
+}
+
+// queued reports whether the stream is played through to a queue entry that follows it.
+func (l *loopBetween) queued() bool {
+	return l.next != nil && l.wholeStream()
+}
+
+// blendHead crossfades samples, which start offset samples into the crossfade region at the
+// end of the loop, with the matching samples of the head using equal-power curves.
+func (l *loopBetween) blendHead(samples [][2]float64, offset int) {
+	x := len(l.head)
+	for i := range samples {
+		k := offset + i
+		if k >= x {
+			break
+		}
+		progress := float64(k) / float64(x)
+		in, out := FadeEqualPower.gain(progress), FadeEqualPower.gain(1-progress)
+		samples[i][0] = samples[i][0]*out + l.head[k][0]*in
+		samples[i][1] = samples[i][1]*out + l.head[k][1]*in
+	}
+}
+
+// snapToZeroCrossing moves pos to the nearest sample within window where the mono sum of s
+// changes sign. The position of s is restored afterwards; without a crossing pos is returned.
+func snapToZeroCrossing(s beep.StreamSeeker, pos, window int) int {
+	resume := s.Position()
+	defer s.Seek(resume)
+	from := max(pos-window, 0)
+	to := min(pos+window, s.Len())
+	if to-from < 2 || s.Seek(from) != nil {
+		return pos
+	}
+	buf := make([][2]float64, to-from)
+	read := 0
+	for read < len(buf) {
+		n, ok := s.Stream(buf[read:])
+		read += n
+		if !ok {
+			break
+		}
+	}
+	best, bestDist := pos, window+1
+	for i := 1; i < read; i++ {
+		a, b := buf[i-1][0]+buf[i-1][1], buf[i][0]+buf[i][1]
+		if (a < 0) != (b < 0) || b == 0 {
+			if d := abs(from + i - pos); d < bestDist {
+				best, bestDist = from+i, d
+			}
+		}
+	}
+	return best
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// seekCounter counts the seeks made on a stream.
+type seekCounter struct {
+	beep.StreamSeeker
+	seeks int
+}
+
+func (s *seekCounter) Seek(p int) error {
+	s.seeks++
+	return s.StreamSeeker.Seek(p)
+}
+
+func TestLoopHeadCached(t *testing.T) {
+	mts := newTestSession(t, 10)
+	s := &seekCounter{StreamSeeker: mts}
+	l := LoopBetween(-1, 1000, 2000, s)
+	l.xfade = 100
+	wraps := 0
+	l.onWrap = func() { wraps++ }
+	buf := make([][2]float64, 256)
+	stream := func(n int) {
+		for i := 0; i < n/len(buf); i++ {
+			l.Stream(buf)
+		}
+	}
+	if err := s.Seek(1000); err != nil {
+		t.Fatal(err)
+	}
+	s.seeks = 0
+	stream(5120)
+	// one seek per wrap, plus two to read the head on the first pass only
+	if s.seeks != wraps+2 {
+		t.Errorf("%d seeks in %d passes, want %d", s.seeks, wraps, wraps+2)
+	}
+
+	ap = &audioPanel{loop: l}
+	s.seeks, wraps = 0, 0
+	mixChanged()
+	stream(2048)
+	if s.seeks != wraps+2 {
+		t.Errorf("after mixChanged: %d seeks in %d passes, want %d", s.seeks, wraps, wraps+2)
+	}
+	l.start = 1100
+	s.seeks, wraps = 0, 0
+	stream(2048)
+	if s.seeks != wraps+2 {
+		t.Errorf("after moving the start: %d seeks in %d passes, want %d", s.seeks, wraps, wraps+2)
+	}
+}
+
+func TestLoopThenStop(t *testing.T) {
+	newTestSession(t, 10)
+	execute(t, "loop", "1s", "2s", "--times", "1", "--then", "stop")
+	buf := make([][2]float64, 256)
+	output.Lock()
+	for i := 0; i < 8 && !ap.ctrl.Paused; i++ {
+		ap.loop.Stream(buf)
+	}
+	paused, pos := ap.ctrl.Paused, ap.streamer.Position()
+	output.Unlock()
+	if !paused || pos != 2000 {
+		t.Fatalf("after the last repetition: paused %v at %d, want paused at 2000 until the seek", paused, pos)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		output.Lock()
+		pos = ap.streamer.Position()
+		output.Unlock()
+		if pos == 1000 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("position %d, want the loop start 1000", pos)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if ap.loop.remains != 1 {
+		t.Errorf("%d repetitions left, want 1", ap.loop.remains)
+	}
+}
@@ -0,0 +1,368 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// newMarker builds a set marker at the given sample position of the loaded session.
+func newMarker(samplePosition int, label string) PlaybackPosition {
+	return PlaybackPosition{
+		SamplePosition: samplePosition,
+		PlayPosition:   ap.sampleRate.D(samplePosition).Seconds(),
+		Label:          label,
+		Set:            true,
+	}
+}
+
+// resolveMarker turns a marker index or label into an index into Markers.
+func resolveMarker(arg string) (int, error) {
+	if index, err := strconv.Atoi(arg); err == nil {
+		if index < 0 || index >= len(Markers) || !Markers[index].Set {
+			return -1, fmt.Errorf("marker %d does not exist", index)
+		}
+		return index, nil
+	}
+	if index := markerByLabel(arg); index >= 0 {
+		return index, nil
+	}
+	return -1, fmt.Errorf("marker %q does not exist", arg)
+}
+
+// markerByLabel returns the index of the set marker with the label, ignoring case, or -1.
+func markerByLabel(label string) int {
+	for i, m := range Markers {
+		if m.Set && m.Label != "" && strings.EqualFold(m.Label, label) {
+			return i
+		}
+	}
+	return -1
+}
+
+// markerRange resolves either a single region marker or a start and an end position into a
+// sample range, along with a description for messages. Positions are parsed by parsePosition;
+// a single relative time such as "+8s" spans from the playhead, and a relative end is taken
+// from the start.
+func markerRange(args []string) (start, end int, desc string, err error) {
+	output.Lock()
+	playhead := ap.streamer.Position()
+	output.Unlock()
+	if len(args) == 1 {
+		if isRelativePosition(args[0]) {
+			end, endDesc, err := parsePosition(args[0], playhead)
+			if err != nil {
+				return 0, 0, "", err
+			}
+			if end <= playhead {
+				return 0, 0, "", fmt.Errorf("a single relative position must lie after the playhead")
+			}
+			return playhead, end, fmt.Sprintf("the playhead (%s) and %s", formatClock(ap.sampleRate.D(playhead).Seconds()), endDesc), nil
+		}
+		index, err := resolveMarker(args[0])
+		if err != nil {
+			return 0, 0, "", err
+		}
+		m := Markers[index]
+		if !m.IsRegion() {
+			return 0, 0, "", fmt.Errorf("marker %s is not a region; give a start and an end position", markerName(index))
+		}
+		return m.SamplePosition, m.EndPosition, "region " + markerName(index), nil
+	}
+	start, startDesc, err := parsePosition(args[0], playhead)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to parse start position: %w", err)
+	}
+	end, endDesc, err := parsePosition(args[1], start)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to parse end position: %w", err)
+	}
+	if start >= end {
+		return 0, 0, "", fmt.Errorf("start position must be before end position")
+	}
+	if _, err := resolveMarker(args[0]); err == nil {
+		if _, err := resolveMarker(args[1]); err == nil {
+			startDesc, endDesc = strings.TrimPrefix(startDesc, "marker "), strings.TrimPrefix(endDesc, "marker ")
+			return start, end, fmt.Sprintf("markers %s and %s", startDesc, endDesc), nil
+		}
+	}
+	return start, end, fmt.Sprintf("%s and %s", startDesc, endDesc), nil
+}
+
+func isRelativePosition(arg string) bool {
+	return strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-")
+}
+
+// parsePosition resolves a position argument into a sample position of the session, with a
+// description for messages. It accepts a marker index or label, a time such as "1:23.5",
+// "1:02:03" or "83.5s", a time relative to base such as "+8s" or "-2s", or, with a tempo set,
+// a bar position such as "b17" or "b17:3".
+func parsePosition(arg string, base int) (int, string, error) {
+	var pos int
+	switch {
+	case isRelativePosition(arg):
+		delta, err := parseSampleDelta(arg)
+		if err != nil {
+			return 0, "", err
+		}
+		pos = base + delta
+	case isBarPosition(arg):
+		var err error
+		if pos, err = parseBarPosition(arg); err != nil {
+			return 0, "", err
+		}
+		if pos >= 0 && pos <= ap.streamer.Len() {
+			return pos, "bar " + tempo.format(pos), nil
+		}
+	case strings.Contains(arg, ":"):
+		seconds, err := parseClock(arg)
+		if err != nil {
+			return 0, "", err
+		}
+		pos = ap.sampleRate.N(time.Duration(seconds * float64(time.Second)))
+	default:
+		if index, err := resolveMarker(arg); err == nil {
+			return Markers[index].SamplePosition, "marker " + markerName(index), nil
+		}
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return 0, "", fmt.Errorf("%q is neither a marker nor a time like 1:23.5 or 83.5s", arg)
+		}
+		pos = ap.sampleRate.N(d)
+	}
+	if pos < 0 || pos > ap.streamer.Len() {
+		return 0, "", fmt.Errorf("position %s is outside of the session (0:00.000 - %s)",
+			formatClock(ap.sampleRate.D(pos).Seconds()), formatClock(ap.sampleRate.D(ap.streamer.Len()).Seconds()))
+	}
+	return pos, formatClock(ap.sampleRate.D(pos).Seconds()), nil
+}
+
+// isNegativeArg reports whether arg is a negative number or a position before its base like
+// "-2s", as opposed to a flag.
+func isNegativeArg(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && (isDigit(arg[1]) || arg[1] == '.' || strings.EqualFold(arg[1:], "inf"))
+}
+
+// allowNegativeArgs lets the arguments of commands start with a minus sign, as in "goto -2s",
+// "loop -2s +4s" or "gain 1 -6", which cobra would reject as unknown shorthand flags. Flag
+// parsing is turned off for these commands and done by parseFlagsAroundArgs instead.
+func allowNegativeArgs(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		run, validate := c.Run, c.Args
+		c.DisableFlagParsing = true
+		c.Args = cobra.ArbitraryArgs
+		c.Run = func(cmd *cobra.Command, args []string) {
+			args, err := parseFlagsAroundArgs(cmd, args)
+			if help, _ := cmd.Flags().GetBool("help"); help || errors.Is(err, pflag.ErrHelp) {
+				cmd.Help()
+				return
+			}
+			if err == nil && validate != nil {
+				err = validate(cmd, args)
+			}
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				return
+			}
+			run(cmd, args)
+		}
+	}
+}
+
+// parseFlagsAroundArgs parses the flags among args and returns the remaining arguments. An
+// argument that looks like a negative number or position is never taken for a flag.
+func parseFlagsAroundArgs(cmd *cobra.Command, args []string) ([]string, error) {
+	// merges the persistent flags of the parent commands into cmd.Flags()
+	cmd.InheritedFlags()
+	flags := cmd.Flags()
+	var flagArgs, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case arg == "-" || !strings.HasPrefix(arg, "-") || isNegativeArg(arg):
+			positional = append(positional, arg)
+		default:
+			flagArgs = append(flagArgs, arg)
+			name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			var f *pflag.Flag
+			if strings.HasPrefix(arg, "--") {
+				f = flags.Lookup(name)
+			} else if len(name) == 1 {
+				f = flags.ShorthandLookup(name)
+			}
+			// the value of a flag may be a separate argument, even a negative number
+			if f != nil && !hasValue && f.NoOptDefVal == "" && i+1 < len(args) {
+				i++
+				flagArgs = append(flagArgs, args[i])
+			}
+		}
+	}
+	if err := flags.Parse(flagArgs); err != nil {
+		return nil, err
+	}
+	return positional, nil
+}
+
+// parseClock parses "m:ss.fff" or "h:mm:ss.fff" into seconds.
+func parseClock(arg string) (float64, error) {
+	parts := strings.Split(arg, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", arg)
+	}
+	seconds := 0.0
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 || (i > 0 && v >= 60) {
+			return 0, fmt.Errorf("invalid time %q", arg)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
+
+// freeMarkerIndex returns the first unused marker slot, preferring the digit keys 1-8
+// (0 and 9 hold the start and end of the session).
+func freeMarkerIndex() int {
+	for i := 1; i < len(Markers) && i < 9; i++ {
+		if !Markers[i].Set {
+			return i
+		}
+	}
+	for i := 10; i < len(Markers); i++ {
+		if !Markers[i].Set {
+			return i
+		}
+	}
+	return max(len(Markers), 10)
+}
+
+// markerName describes a marker for messages, e.g. `3` or `3 "chorus"`.
+func markerName(index int) string {
+	if index >= 0 && index < len(Markers) && Markers[index].Label != "" {
+		return fmt.Sprintf("%d %q", index, Markers[index].Label)
+	}
+	return strconv.Itoa(index)
+}
+
+// formatClock formats seconds as m:ss.mmm.
+func formatClock(seconds float64) string {
+	sign := ""
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	minutes := int(seconds) / 60
+	return fmt.Sprintf("%s%d:%06.3f", sign, minutes, seconds-float64(minutes*60))
+}
+
+// parseSampleDelta parses a relative move given either in samples ("-200", "+4410")
+// or as a duration ("1.5s", "-250ms").
+func parseSampleDelta(arg string) (int, error) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(strings.TrimPrefix(arg, "+"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q (use samples like -200 or a duration like 1.5s)", arg)
+	}
+	if d < 0 {
+		return -ap.sampleRate.N(-d), nil
+	}
+	return ap.sampleRate.N(d), nil
+}
+
+var markersCmd = &cobra.Command{
+	Use:   "markers",
+	Short: "List all markers with their labels, times and sample positions",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireAudioLoaded() {
+			return
+		}
+		for i, m := range Markers {
+			if !m.Set {
+				continue
+			}
+			if m.IsRegion() {
+				end := ap.sampleRate.D(m.EndPosition).Seconds()
+				fmt.Printf("%2d  %-16s %s - %s  (samples %d - %d)\n", i, m.Label, formatClock(m.PlayPosition), formatClock(end), m.SamplePosition, m.EndPosition)
+				continue
+			}
+			fmt.Printf("%2d  %-16s %s  (sample %d)\n", i, m.Label, formatClock(m.PlayPosition), m.SamplePosition)
+		}
+	},
+}
+
+var delMarkerCmd = &cobra.Command{
+	Use:               "delmarker [marker]",
+	Short:             "Delete a marker by index or label",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeMarkerArgs(1, false),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireAudioLoaded() {
+			return
+		}
+		index, err := resolveMarker(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		name := markerName(index)
+		Markers[index] = PlaybackPosition{}
+		saveMarkerSidecar()
+		fmt.Printf("Marker %s deleted\n", name)
+	},
+}
+
+var moveMarkerCmd = &cobra.Command{
+	Use:               "movemarker [marker] [offset]",
+	Short:             "Nudge a marker by samples (e.g. -200) or time (e.g. 0.5s, -250ms)",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeMarkerArgs(1, false),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireAudioLoaded() {
+			return
+		}
+		index, err := resolveMarker(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		delta, err := parseSampleDelta(args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		output.Lock()
+		length := ap.streamer.Len()
+		output.Unlock()
+		old := Markers[index]
+		pos := old.SamplePosition + delta
+		if pos < 0 {
+			pos = 0
+		}
+		if pos >= length {
+			pos = length - 1
+		}
+		Markers[index] = newMarker(pos, old.Label)
+		if old.IsRegion() {
+			Markers[index].EndPosition = min(old.EndPosition+(pos-old.SamplePosition), length)
+		}
+		saveMarkerSidecar()
+		fmt.Printf("Marker %s moved to sample position %d (play position %.3f seconds)\n", markerName(index), pos, Markers[index].PlayPosition)
+	},
+}
+
+func init() {
+	markersCmd.AddCommand(markersImportCmd, markersExportCmd)
+	RootCmd.AddCommand(markersCmd, delMarkerCmd, moveMarkerCmd)
+	allowNegativeArgs(gotoCmd, loopCmd, saveCmd, renderCmd, moveMarkerCmd)
+}
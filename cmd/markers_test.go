@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// testRate keeps test sessions small: one sample per millisecond.
+const testRate = beep.SampleRate(1000)
+
+// newTestSession loads a silent session of the given length in seconds on a null output that is
+// never started, so commands can be run through RootCmd without a sound card. The track is named
+// inside a temporary directory, where commands that save a sidecar write it.
+func newTestSession(t *testing.T, seconds int) *MultiTrackSeeker {
+	t.Helper()
+	outputOnce.Do(func() {})
+	output = &nullOutput{}
+	format = beep.Format{SampleRate: testRate, NumChannels: 2, Precision: 2}
+	buffer := beep.NewBuffer(format)
+	buffer.Append(beep.Silence(seconds * int(testRate)))
+	mts := NewMultiTrackSeeker([]beep.StreamSeeker{}, format)
+	mts.AddTrackWithOffset(buffer.Streamer(0, buffer.Len()), format, filepath.Join(t.TempDir(), "test.wav"), 0)
+	ensureAudioPanel(mts)
+	t.Cleanup(func() {
+		ap = nil
+		Markers = nil
+		tempo = nil
+	})
+	return mts
+}
+
+// execute runs a command line through RootCmd, as the shell does.
+func execute(t *testing.T, args ...string) {
+	t.Helper()
+	RootCmd.SetArgs(args)
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("%v: %s", args, err)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want float64
+		err  bool
+	}{
+		{"1:23.5", 83.5, false},
+		{"0:05", 5, false},
+		{"1:02:03", 3723, false},
+		{"1:60", 0, true},
+		{"1:-5", 0, true},
+		{"1:2:3:4", 0, true},
+		{"a:10", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseClock(tt.arg)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseClock(%q) = %v, %v; want %v, error %v", tt.arg, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	newTestSession(t, 60)
+	Markers[3] = newMarker(12000, "verse")
+	tests := []struct {
+		arg  string
+		base int
+		want int
+		err  bool
+	}{
+		{"0:01.5", 0, 1500, false},
+		{"1:00", 0, 60000, false},
+		{"83.5s", 0, 0, true},
+		{"20s", 0, 20000, false},
+		{"+8s", 10000, 18000, false},
+		{"-2s", 10000, 8000, false},
+		{"-2s", 1000, 0, true},
+		{"3", 0, 12000, false},
+		{"verse", 0, 12000, false},
+		{"chorus", 0, 0, true},
+		{"b2", 0, 0, true}, // no tempo set
+	}
+	for _, tt := range tests {
+		got, _, err := parsePosition(tt.arg, tt.base)
+		if (err != nil) != tt.err || (!tt.err && got != tt.want) {
+			t.Errorf("parsePosition(%q, %d) = %d, %v; want %d, error %v", tt.arg, tt.base, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestNegativePositionArguments(t *testing.T) {
+	newTestSession(t, 60)
+	execute(t, "goto", "30s")
+	execute(t, "goto", "-2s")
+	if got := ap.streamer.Position(); got != 28000 {
+		t.Fatalf("goto -2s from 30s: position %d, want 28000", got)
+	}
+	execute(t, "loop", "-2s", "+4s", "--xfade", "10ms")
+	if ap.loop.start != 26000 || ap.loop.end != 30000 {
+		t.Errorf("loop -2s +4s from 28s: loop %d-%d, want 26000-30000", ap.loop.start, ap.loop.end)
+	}
+	if ap.loop.xfade != 10 {
+		t.Errorf("loop --xfade 10ms: crossfade %d samples, want 10", ap.loop.xfade)
+	}
+	execute(t, "loop", "--", "-4s", "0:25")
+	if ap.loop.start != 24000 || ap.loop.end != 25000 {
+		t.Errorf("loop -- -4s 0:25 from 28s: loop %d-%d, want 24000-25000", ap.loop.start, ap.loop.end)
+	}
+}
+
+func TestMoveMarkerBack(t *testing.T) {
+	newTestSession(t, 10)
+	Markers[3] = newMarker(5000, "verse")
+	execute(t, "movemarker", "verse", "-250ms")
+	execute(t, "movemarker", "3", "-200")
+	if got := Markers[3].SamplePosition; got != 4550 {
+		t.Errorf("marker at %d, want 4550", got)
+	}
+}
@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"time"
 
 	"github.com/gopxl/beep/v2"
@@ -12,6 +15,23 @@ type Track struct {
 	TrackNumber int
 	TrackName   string
 	Offset      float64
+	SourceRate  beep.SampleRate // sample rate of the file before resampling to the session rate
+	Gain        float64         // in dB, 0 is unity
+	Pan         float64         // -1 is hard left, 0 is center, +1 is hard right
+	Mute        bool
+	Solo        bool
+	Fader       *Fader
+	Pitch       *PitchShifter
+	Transpose   int  // semitones the notes of a MIDI track were moved by when rendering
+	Generated   bool // built by gordon rather than loaded from a file, e.g. the click track
+}
+
+// channelGains returns the linear left/right multipliers for the track's gain and pan.
+// Panning uses an equal-power law normalized so that a centered track stays at unity.
+func (t *Track) channelGains() (left, right float64) {
+	amp := math.Pow(10, t.Gain/20)
+	angle := (t.Pan + 1) * math.Pi / 4
+	return amp * math.Cos(angle) * math.Sqrt2, amp * math.Sin(angle) * math.Sqrt2
 }
 
 type MultiTrackSeeker struct {
@@ -19,21 +39,38 @@ type MultiTrackSeeker struct {
 	format   beep.Format
 	position int
 	length   int
+	speed    float64 // playback speed, used to keep fades in wall-clock time
+	pitch    float64 // transposition in semitones, applied to tracks as they are added
 }
 
-func (mts *MultiTrackSeeker) AddTrackWithOffset(track beep.StreamSeeker, fileName string, offset float64) int {
+// AddTrackWithOffset adds a track that starts offset seconds into the session. Tracks whose
+// sample rate differs from the session rate are resampled so they keep their pitch and timing.
+func (mts *MultiTrackSeeker) AddTrackWithOffset(track beep.StreamSeeker, trackFormat beep.Format, fileName string, offset float64) int {
 	nextTrackNumber := 1
 	for _, t := range mts.Tracks {
 		if t.TrackNumber >= nextTrackNumber {
 			nextTrackNumber = t.TrackNumber + 1
 		}
 	}
+	// Pitch shifting works on the decoded audio so MIDI tracks can swap in re-rendered notes.
+	sourceRate := trackFormat.SampleRate
+	if sourceRate == 0 {
+		sourceRate = mts.format.SampleRate
+	}
+	pitch := NewPitchShifter(track, sourceRate)
+	track = pitch
+	if trackFormat.SampleRate != 0 && trackFormat.SampleRate != mts.format.SampleRate {
+		track = NewResampleSeeker(track, trackFormat.SampleRate, mts.format.SampleRate)
+	}
+	// Wrap the track in a fader so fades are applied relative to the track itself.
+	fader := NewFader(track, mts.format.SampleRate)
+	fader.SetSpeed(mts.speed)
 	// Create silence streamer for the offset duration.
 	silenceSamples := mts.format.SampleRate.N(time.Duration(offset * float64(time.Second)))
 	// Combine silence with the actual track using a CompositeSeeker.
 	composite := &CompositeSeeker{
 		silenceLen: silenceSamples,
-		track:      track,
+		track:      fader,
 		pos:        0,
 	}
 
@@ -42,6 +79,9 @@ func (mts *MultiTrackSeeker) AddTrackWithOffset(track beep.StreamSeeker, fileNam
 		TrackNumber: nextTrackNumber,
 		TrackName:   fileName,
 		Offset:      offset,
+		SourceRate:  trackFormat.SampleRate,
+		Fader:       fader,
+		Pitch:       pitch,
 	}
 	mts.Tracks = append(mts.Tracks, newTrack)
 	// Update overall length: include silence plus track length.
@@ -52,8 +92,26 @@ func (mts *MultiTrackSeeker) AddTrackWithOffset(track beep.StreamSeeker, fileNam
 	return newTrack.TrackNumber
 }
 
-func (mts *MultiTrackSeeker) AddTrack(track beep.StreamSeeker, fileName string) int {
-	return mts.AddTrackWithOffset(track, fileName, 0)
+// AddGeneratedTrack adds a track that is synthesized rather than decoded, such as the click
+// track. Generated tracks are mixed like any other but are not saved with sessions or stems.
+func (mts *MultiTrackSeeker) AddGeneratedTrack(s beep.StreamSeeker, name string) *Track {
+	nextTrackNumber := 1
+	for _, t := range mts.Tracks {
+		if t.TrackNumber >= nextTrackNumber {
+			nextTrackNumber = t.TrackNumber + 1
+		}
+	}
+	mts.Tracks = append(mts.Tracks, Track{
+		Streamer:    s,
+		TrackNumber: nextTrackNumber,
+		TrackName:   name,
+		Generated:   true,
+	})
+	return &mts.Tracks[len(mts.Tracks)-1]
+}
+
+func (mts *MultiTrackSeeker) AddTrack(track beep.StreamSeeker, trackFormat beep.Format, fileName string) int {
+	return mts.AddTrackWithOffset(track, trackFormat, fileName, 0)
 }
 
 func (mts *MultiTrackSeeker) RemoveTrack(index int) error {
@@ -61,14 +119,59 @@ func (mts *MultiTrackSeeker) RemoveTrack(index int) error {
 		return fmt.Errorf("track index %d out of range", index)
 	}
 	mts.Tracks = append(mts.Tracks[:index], mts.Tracks[index+1:]...)
-	// Recalculate the overall length based on the remaining tracks.
+	mts.updateLength()
+	return nil
+}
+
+// updateLength recalculates the overall length from the tracks, after one was removed or
+// changed its length.
+func (mts *MultiTrackSeeker) updateLength() {
 	mts.length = 0
 	for _, t := range mts.Tracks {
 		if t.Streamer.Len() > mts.length {
 			mts.length = t.Streamer.Len()
 		}
 	}
-	return nil
+}
+
+// withMix applies the track's gain and pan to s the same way MultiTrackSeeker does when mixing.
+func (t *Track) withMix(s beep.Streamer) beep.Streamer {
+	left, right := t.channelGains()
+	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		n, ok = s.Stream(samples)
+		for i := range samples[:n] {
+			samples[i][0] *= left
+			samples[i][1] *= right
+		}
+		return n, ok
+	})
+}
+
+// TrackByNumber returns the track with the given track number so its mix settings can be changed in place.
+func (mts *MultiTrackSeeker) TrackByNumber(trackNumber int) (*Track, error) {
+	for i := range mts.Tracks {
+		if mts.Tracks[i].TrackNumber == trackNumber {
+			return &mts.Tracks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("track number %d not found", trackNumber)
+}
+
+// audible reports whether a track contributes to the mix, honouring mute and solo.
+// As soon as one track is soloed, only soloed tracks are heard.
+func (mts *MultiTrackSeeker) audible(t *Track) bool {
+	if t.Mute {
+		return false
+	}
+	if t.Solo {
+		return true
+	}
+	for i := range mts.Tracks {
+		if mts.Tracks[i].Solo {
+			return false
+		}
+	}
+	return true
 }
 
 func (mts *MultiTrackSeeker) Stream(samples [][2]float64) (n int, ok bool) {
@@ -82,11 +185,17 @@ func (mts *MultiTrackSeeker) Stream(samples [][2]float64) (n int, ok bool) {
 	}
 
 	buffer := make([][2]float64, len(samples))
-	for _, t := range mts.Tracks {
+	for i := range mts.Tracks {
+		t := &mts.Tracks[i]
+		// Silent tracks are still streamed so they stay in sync with the others.
 		nTrack, _ := t.Streamer.Stream(buffer)
-		for i := 0; i < nTrack && i < len(samples); i++ {
-			samples[i][0] += buffer[i][0]
-			samples[i][1] += buffer[i][1]
+		if !mts.audible(t) {
+			continue
+		}
+		left, right := t.channelGains()
+		for j := 0; j < nTrack && j < len(samples); j++ {
+			samples[j][0] += buffer[j][0] * left
+			samples[j][1] += buffer[j][1] * right
 		}
 	}
 	mts.position += len(samples)
@@ -106,6 +215,16 @@ func (mts *MultiTrackSeeker) Seek(p int) error {
 	return nil
 }
 
+// SetSpeed propagates the playback speed to every track's fader.
+func (mts *MultiTrackSeeker) SetSpeed(speed float64) {
+	mts.speed = speed
+	for _, t := range mts.Tracks {
+		if t.Fader != nil {
+			t.Fader.SetSpeed(speed)
+		}
+	}
+}
+
 func (mts *MultiTrackSeeker) Len() int {
 	return mts.length
 }
@@ -118,6 +237,21 @@ func (mts *MultiTrackSeeker) Err() error {
 	return nil
 }
 
+// Close closes the decoders of the tracks, and with them the files they read from. The session
+// must not be streamed afterwards.
+func (mts *MultiTrackSeeker) Close() error {
+	var errs []error
+	for _, t := range mts.Tracks {
+		if t.Pitch == nil {
+			continue
+		}
+		if c, ok := t.Pitch.Source.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
 type CompositeSeeker struct {
 	silenceLen int
 	track      beep.StreamSeeker
@@ -193,6 +327,7 @@ func NewMultiTrackSeeker(streams []beep.StreamSeeker, format beep.Format) *Multi
 			Streamer:    s,
 			TrackNumber: i + 1,
 			TrackName:   fmt.Sprintf("Track %d", i+1),
+			SourceRate:  format.SampleRate,
 		})
 	}
 	return &MultiTrackSeeker{
@@ -200,5 +335,6 @@ func NewMultiTrackSeeker(streams []beep.StreamSeeker, format beep.Format) *Multi
 		format:   format,
 		position: 0,
 		length:   length,
+		speed:    1,
 	}
 }
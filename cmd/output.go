@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+// audioOutput is the backend that pulls the mixed audio of the application. Lock and Unlock
+// guard every streamer that is registered with Play, just like speaker.Lock does.
+type audioOutput interface {
+	Init(sampleRate beep.SampleRate) error
+	Play(s ...beep.Streamer)
+	Clear()
+	Lock()
+	Unlock()
+}
+
+var (
+	output        audioOutput = speakerOutput{}
+	outputName    string
+	outputClock   string
+	outputOnce    sync.Once
+	outputInitErr error
+)
+
+// speakerOutput plays through the sound card using beep's speaker package.
+type speakerOutput struct{}
+
+func (speakerOutput) Init(sampleRate beep.SampleRate) error {
+	return speaker.Init(sampleRate, sampleRate.N(time.Second/10))
+}
+
+func (speakerOutput) Play(s ...beep.Streamer) { speaker.Play(s...) }
+func (speakerOutput) Clear()                  { speaker.Clear() }
+func (speakerOutput) Lock()                   { speaker.Lock() }
+func (speakerOutput) Unlock()                 { speaker.Unlock() }
+
+// nullOutput discards the audio. It pulls from its mixer either on a real-time clock, so
+// playback positions advance as they would on a sound card, or as fast as possible. The fast
+// clock only rests once nothing is playing: playback that never ends, such as a loop without
+// --times, keeps it pulling for good. It yields after every chunk so commands still get the lock.
+type nullOutput struct {
+	mu       sync.Mutex
+	mixer    beep.Mixer
+	realtime bool
+}
+
+const nullOutputChunk = time.Second / 100
+
+func (n *nullOutput) Init(sampleRate beep.SampleRate) error {
+	go n.run(sampleRate)
+	return nil
+}
+
+func (n *nullOutput) run(sampleRate beep.SampleRate) {
+	buf := make([][2]float64, sampleRate.N(nullOutputChunk))
+	ticker := time.NewTicker(sampleRate.D(len(buf)))
+	defer ticker.Stop()
+	for {
+		n.mu.Lock()
+		idle := n.mixer.Len() == 0
+		n.mixer.Stream(buf)
+		n.mu.Unlock()
+		if n.realtime || idle {
+			<-ticker.C
+		} else {
+			runtime.Gosched()
+		}
+	}
+}
+
+func (n *nullOutput) Play(s ...beep.Streamer) {
+	n.mu.Lock()
+	n.mixer.Add(s...)
+	n.mu.Unlock()
+}
+
+func (n *nullOutput) Clear() {
+	n.mu.Lock()
+	n.mixer.Clear()
+	n.mu.Unlock()
+}
+
+func (n *nullOutput) Lock()   { n.mu.Lock() }
+func (n *nullOutput) Unlock() { n.mu.Unlock() }
+
+// ensureOutput selects the backend named by --output and initializes it once.
+func ensureOutput() error {
+	outputOnce.Do(func() {
+		switch outputName {
+		case "", "speaker":
+			output = speakerOutput{}
+		case "null":
+			switch outputClock {
+			case "", "realtime":
+				output = &nullOutput{realtime: true}
+			case "fast":
+				output = &nullOutput{}
+			default:
+				outputInitErr = fmt.Errorf("unknown output clock %q (use realtime or fast)", outputClock)
+				return
+			}
+		default:
+			outputInitErr = fmt.Errorf("unknown output %q (use speaker or null)", outputName)
+			return
+		}
+		outputInitErr = output.Init(defaultSampleRate)
+	})
+	if outputInitErr != nil {
+		return fmt.Errorf("failed to init %s output: %w", outputName, outputInitErr)
+	}
+	return nil
+}
@@ -3,17 +3,12 @@ package cmd
 import (
 	"math/bits"
 	"math/rand"
-	"os"
-	"os/signal"
 	"time"
 
 	"github.com/spf13/cobra"
-
-	"github.com/gopxl/beep"
-	"github.com/gopxl/beep/speaker"
 )
 
- // PinkNoise implements beep.Streamer and generates pink noise using the Voss–McCartney algorithm.
+// PinkNoise implements beep.Streamer and generates pink noise using the Voss–McCartney algorithm.
 // It streams infinite pink noise and is fully compliant with the beep.Streamer interface.
 type PinkNoise struct {
 	rng        *rand.Rand
@@ -77,7 +72,7 @@ func (p *PinkNoise) Reset() {
 }
 
 func playPinkNoise() {
-	speaker.Play(NewPinkNoise())
+	output.Play(NewPinkNoise())
 }
 
 var pinkPlaying bool
@@ -87,7 +82,7 @@ var pinkCmd = &cobra.Command{
 	Short: "Toggle pink noise playback",
 	Run: func(cmd *cobra.Command, args []string) {
 		if pinkPlaying {
-			speaker.Clear()
+			output.Clear()
 			pinkPlaying = false
 		} else {
 			playPinkNoise()
@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/midi"
+	"github.com/spf13/cobra"
+)
+
+// PitchShifter transposes a track without changing its tempo: the audio is time stretched by
+// the pitch factor and then resampled back to its original length. Output sample n always
+// corresponds to source sample n, so a shifted track stays aligned with the other tracks.
+type PitchShifter struct {
+	Source     beep.StreamSeeker
+	SampleRate beep.SampleRate
+	semitones  float64
+	pos        int
+	chain      beep.Streamer
+}
+
+func NewPitchShifter(s beep.StreamSeeker, sampleRate beep.SampleRate) *PitchShifter {
+	return &PitchShifter{Source: s, SampleRate: sampleRate, pos: s.Position()}
+}
+
+// Semitones returns the current shift.
+func (p *PitchShifter) Semitones() float64 {
+	return p.semitones
+}
+
+// SetSemitones changes the shift, continuing from the current position.
+func (p *PitchShifter) SetSemitones(semitones float64) error {
+	p.semitones = semitones
+	return p.Seek(p.pos)
+}
+
+// SetSource replaces the source, e.g. with a re-rendered MIDI file, continuing from the current position.
+func (p *PitchShifter) SetSource(s beep.StreamSeeker) error {
+	p.Source = s
+	return p.Seek(min(p.pos, s.Len()))
+}
+
+func (p *PitchShifter) Stream(samples [][2]float64) (n int, ok bool) {
+	remaining := p.Len() - p.pos
+	if remaining <= 0 {
+		return 0, false
+	}
+	samples = samples[:min(len(samples), remaining)]
+	if p.chain == nil {
+		n, ok = p.Source.Stream(samples)
+		p.pos += n
+		return n, ok
+	}
+	for n < len(samples) {
+		m, more := p.chain.Stream(samples[n:])
+		n += m
+		if !more {
+			break
+		}
+	}
+	// The stretcher can end a few samples early; pad so the track keeps its length.
+	clear(samples[n:])
+	p.pos += len(samples)
+	return len(samples), true
+}
+
+func (p *PitchShifter) Err() error {
+	return p.Source.Err()
+}
+
+func (p *PitchShifter) Len() int {
+	return p.Source.Len()
+}
+
+func (p *PitchShifter) Position() int {
+	return p.pos
+}
+
+func (p *PitchShifter) Seek(pos int) error {
+	if err := p.Source.Seek(pos); err != nil {
+		return err
+	}
+	p.pos = pos
+	p.chain = nil
+	if p.semitones != 0 {
+		factor := math.Pow(2, p.semitones/12)
+		stretcher := NewTimeStretcher(p.SampleRate, p.Source)
+		stretcher.SetRatio(1 / factor)
+		p.chain = beep.ResampleRatio(4, factor, stretcher)
+	}
+	return nil
+}
+
+func isMIDIFile(file string) bool {
+	return isFormat(file, "midi")
+}
+
+// decodeMIDI renders a Standard MIDI File with its notes transposed by the given semitones.
+func decodeMIDI(r io.ReadCloser, transpose int) (beep.StreamSeeker, beep.Format, error) {
+	sf, err := ensureMidiSoundFont()
+	if err != nil {
+		r.Close()
+		return nil, beep.Format{}, fmt.Errorf("failed to load MIDI soundfont: %w", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	if transpose != 0 {
+		if data, err = transposeSMF(data, transpose); err != nil {
+			return nil, beep.Format{}, err
+		}
+	}
+	midiStream, decodedFormat, err := midi.Decode(io.NopCloser(bytes.NewReader(data)), sf, defaultSampleRate)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	buffer := beep.NewBuffer(decodedFormat)
+	buffer.Append(midiStream)
+	return buffer.Streamer(0, buffer.Len()), decodedFormat, nil
+}
+
+// transposeSMF returns a copy of a Standard MIDI File with the note numbers of all note on,
+// note off and poly aftertouch events shifted by semitones. The percussion channel 10 is left
+// alone and notes are clamped to the MIDI range.
+func transposeSMF(data []byte, semitones int) ([]byte, error) {
+	out := bytes.Clone(data)
+	truncated := fmt.Errorf("invalid MIDI file: truncated")
+	i := 0
+	readVarLen := func(end int) (int, error) {
+		v := 0
+		for k := 0; k < 4; k++ {
+			if i >= end {
+				return 0, truncated
+			}
+			b := out[i]
+			i++
+			v = v<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				return v, nil
+			}
+		}
+		return 0, fmt.Errorf("invalid MIDI file: bad variable-length number")
+	}
+	for i+8 <= len(out) {
+		id := string(out[i : i+4])
+		end := i + 8 + int(binary.BigEndian.Uint32(out[i+4:i+8]))
+		i += 8
+		if end > len(out) {
+			return nil, truncated
+		}
+		if id != "MTrk" {
+			i = end
+			continue
+		}
+		var status byte
+		for i < end {
+			if _, err := readVarLen(end); err != nil {
+				return nil, err
+			}
+			if i >= end {
+				return nil, truncated
+			}
+			if out[i]&0x80 != 0 {
+				status = out[i]
+				i++
+			} else if status == 0 {
+				return nil, fmt.Errorf("invalid MIDI file: data byte without status")
+			}
+			switch {
+			case status == 0xff:
+				i++ // meta event type
+				length, err := readVarLen(end)
+				if err != nil {
+					return nil, err
+				}
+				i += length
+				status = 0
+			case status == 0xf0 || status == 0xf7:
+				length, err := readVarLen(end)
+				if err != nil {
+					return nil, err
+				}
+				i += length
+				status = 0
+			default:
+				size := 2
+				if kind := status & 0xf0; kind == 0xc0 || kind == 0xd0 {
+					size = 1
+				}
+				if i+size > end {
+					return nil, truncated
+				}
+				kind, channel := status&0xf0, status&0x0f
+				if (kind == 0x80 || kind == 0x90 || kind == 0xa0) && channel != 9 {
+					out[i] = byte(max(0, min(127, int(out[i])+semitones)))
+				}
+				i += size
+			}
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// applyTrackPitch transposes a track of mts by semitones. MIDI tracks are rendered again with
+// their notes moved by the whole semitones, only the remaining cents are shifted as audio.
+func applyTrackPitch(mts *MultiTrackSeeker, t *Track, semitones float64) error {
+	if t.Pitch == nil {
+		return fmt.Errorf("track %d does not support pitch shifting", t.TrackNumber)
+	}
+	shift := semitones
+	if isMIDIFile(t.TrackName) {
+		whole := int(math.Round(semitones))
+		shift = semitones - float64(whole)
+		if whole != t.Transpose {
+			f, err := openFile(t.TrackName)
+			if err != nil {
+				return err
+			}
+			streamer, _, err := decodeMIDI(f, whole)
+			if err != nil {
+				return fmt.Errorf("failed to render %s: %w", t.TrackName, err)
+			}
+			output.Lock()
+			defer output.Unlock()
+			defer mixChanged()
+			t.Transpose = whole
+			if err := t.Pitch.SetSource(streamer); err != nil {
+				return err
+			}
+			// the notes moved, so the release of the last one may end earlier or later
+			trackResized(mts)
+			return t.Pitch.SetSemitones(shift)
+		}
+	}
+	output.Lock()
+	defer output.Unlock()
+	defer mixChanged()
+	return t.Pitch.SetSemitones(shift)
+}
+
+// trackResized recalculates the length of mts after one of its tracks changed length. When mts
+// is playing, the default end marker and a loop ending at the old end move along. It must be
+// called with the output locked.
+func trackResized(mts *MultiTrackSeeker) {
+	old := mts.Len()
+	mts.updateLength()
+	if ap == nil || ap.streamer != mts || mts.Len() == old {
+		return
+	}
+	if len(Markers) > 9 && Markers[9].Label == "end" && Markers[9].SamplePosition == old-1 {
+		Markers[9] = newMarker(mts.Len()-1, "end")
+	}
+	if ap.loop.end == old || ap.loop.end > mts.Len() {
+		ap.loop.end = mts.Len()
+	}
+	if ap.loop.start >= ap.loop.end {
+		ap.loop.unloop()
+	}
+}
+
+// setPitch transposes every track of the session and remembers the shift for tracks loaded later.
+func setPitch(mts *MultiTrackSeeker, semitones float64) error {
+	mts.pitch = semitones
+	for i := range mts.Tracks {
+		if mts.Tracks[i].Generated {
+			continue
+		}
+		if err := applyTrackPitch(mts, &mts.Tracks[i], semitones); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatSemitones prints a shift like "+2 semitones" or "-1 semitones 30 cents".
+func formatSemitones(semitones float64) string {
+	cents := int(math.Round(semitones * 100))
+	whole, rest := cents/100, cents%100
+	if rest == 0 {
+		return fmt.Sprintf("%+d semitones", whole)
+	}
+	return fmt.Sprintf("%+d semitones %+d cents", whole, rest)
+}
+
+var pitchCmd = &cobra.Command{
+	Use:   "pitch [semitones] [cents]",
+	Short: "Transpose playback by semitones and cents without changing the tempo (pitch 0 resets)",
+	Long: `Transpose playback by semitones and optional cents without changing the tempo, e.g.
+"pitch -2" or "pitch 0 -30" for a recording tuned 30 cents flat. The shift combines with speed.
+MIDI tracks are transposed note by note instead of being shifted as audio; the drum channel is
+left alone. Without arguments the current shift is shown.`,
+	Args: cobra.RangeArgs(0, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		mts := requireMultiTrack()
+		if mts == nil {
+			return
+		}
+		if len(args) == 0 {
+			fmt.Printf("Pitch: %s\n", formatSemitones(mts.pitch))
+			return
+		}
+		semitones, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			fmt.Printf("Failed to parse semitones: %s\n", err)
+			return
+		}
+		if len(args) > 1 {
+			cents, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				fmt.Printf("Failed to parse cents: %s\n", err)
+				return
+			}
+			semitones += cents / 100
+		}
+		if math.IsNaN(semitones) || math.Abs(semitones) > 24 {
+			fmt.Println("Pitch shift is limited to two octaves up or down")
+			return
+		}
+		if err := setPitch(mts, semitones); err != nil {
+			fmt.Printf("Failed to set pitch: %s\n", err)
+			return
+		}
+		fmt.Printf("Pitch set to %s\n", formatSemitones(semitones))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(pitchCmd)
+	allowNegativeArgs(pitchCmd)
+}
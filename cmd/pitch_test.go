@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+func TestTrackResized(t *testing.T) {
+	mts := newTestSession(t, 10)
+	// a re-render that comes out two seconds longer
+	buffer := beep.NewBuffer(format)
+	buffer.Append(beep.Silence(12 * int(testRate)))
+	if err := mts.Tracks[0].Pitch.SetSource(buffer.Streamer(0, buffer.Len())); err != nil {
+		t.Fatal(err)
+	}
+	trackResized(mts)
+	if mts.Len() != 12000 {
+		t.Errorf("length %d, want 12000", mts.Len())
+	}
+	if Markers[9].SamplePosition != 11999 {
+		t.Errorf("end marker at %d, want 11999", Markers[9].SamplePosition)
+	}
+	if ap.loop.end != 12000 {
+		t.Errorf("loop end %d, want 12000", ap.loop.end)
+	}
+}
+
+// smf builds a format 0 Standard MIDI File with one track holding events.
+func smf(events ...byte) []byte {
+	data := []byte("MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk")
+	n := len(events)
+	data = append(data, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	return append(data, events...)
+}
+
+func TestTransposeSMF(t *testing.T) {
+	endOfTrack := []byte{0x00, 0xff, 0x2f, 0x00}
+	tests := []struct {
+		name      string
+		events    []byte
+		semitones int
+		want      []byte // nil for an error
+	}{
+		{
+			name:      "note on and off",
+			events:    []byte{0x00, 0x90, 60, 100, 0x60, 0x80, 60, 0},
+			semitones: 2,
+			want:      []byte{0x00, 0x90, 62, 100, 0x60, 0x80, 62, 0},
+		},
+		{
+			name:      "running status and poly aftertouch",
+			events:    []byte{0x00, 0x91, 60, 100, 0x00, 64, 100, 0x10, 0xa1, 67, 30},
+			semitones: -3,
+			want:      []byte{0x00, 0x91, 57, 100, 0x00, 61, 100, 0x10, 0xa1, 64, 30},
+		},
+		{
+			name:      "drum channel stays",
+			events:    []byte{0x00, 0x99, 36, 100, 0x00, 0x90, 36, 100},
+			semitones: 5,
+			want:      []byte{0x00, 0x99, 36, 100, 0x00, 0x90, 41, 100},
+		},
+		{
+			name:      "clamped to the MIDI range",
+			events:    []byte{0x00, 0x90, 126, 100, 0x00, 0x90, 2, 100},
+			semitones: 5,
+			want:      []byte{0x00, 0x90, 127, 100, 0x00, 0x90, 7, 100},
+		},
+		{
+			name: "program change, tempo and sysex are skipped",
+			events: []byte{0x00, 0xc0, 60, 0x00, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20,
+				0x00, 0xf0, 0x02, 0x7e, 0xf7, 0x81, 0x00, 0x90, 60, 100},
+			semitones: 1,
+			want: []byte{0x00, 0xc0, 60, 0x00, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20,
+				0x00, 0xf0, 0x02, 0x7e, 0xf7, 0x81, 0x00, 0x90, 61, 100},
+		},
+		{
+			name:      "truncated event",
+			events:    []byte{0x00, 0x90, 60},
+			semitones: 1,
+		},
+		{
+			name:      "data byte without status",
+			events:    []byte{0x00, 60, 100},
+			semitones: 1,
+		},
+	}
+	for _, tt := range tests {
+		events := tt.events
+		if tt.want != nil {
+			events = append(append([]byte(nil), events...), endOfTrack...)
+		}
+		data := smf(events...)
+		orig := bytes.Clone(data)
+		got, err := transposeSMF(data, tt.semitones)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		want := smf(append(append([]byte(nil), tt.want...), endOfTrack...)...)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got % x, want % x", tt.name, got, want)
+		}
+		if !bytes.Equal(data, orig) {
+			t.Errorf("%s: input was modified", tt.name)
+		}
+	}
+}
+
+func TestPitchDown(t *testing.T) {
+	mts := newTestSession(t, 1)
+	execute(t, "pitch", "-2", "-30")
+	if mts.pitch != -2.3 || mts.Tracks[0].Pitch.Semitones() != -2.3 {
+		t.Errorf("pitch %v, track shifted by %v; want -2.3", mts.pitch, mts.Tracks[0].Pitch.Semitones())
+	}
+	for _, args := range [][]string{{"NaN"}, {"Inf"}, {"-Inf"}, {"0", "NaN"}, {"1", "-Inf"}} {
+		execute(t, append([]string{"pitch"}, args...)...)
+		if mts.pitch != -2.3 {
+			t.Errorf("pitch %v: shift %v, want it left at -2.3", args, mts.pitch)
+		}
+	}
+}
@@ -11,12 +11,7 @@ import (
 
 	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/effects"
-	"github.com/gopxl/beep/v2/flac"
 	"github.com/gopxl/beep/v2/midi"
-	"github.com/gopxl/beep/v2/mp3"
-	"github.com/gopxl/beep/v2/speaker"
-	"github.com/gopxl/beep/v2/vorbis"
-	"github.com/gopxl/beep/v2/wav"
 
 	"github.com/spf13/cobra"
 )
@@ -24,7 +19,8 @@ import (
 var (
 	Markers           []PlaybackPosition
 	format            beep.Format
-	midiSoundFontOnce sync.Once
+	midiSoundFontMu   sync.Mutex
+	midiSoundFontPath string // soundFontPath the soundfont or error below came from
 	midiSoundFont     *midi.SoundFont
 	midiSoundFontErr  error
 )
@@ -33,28 +29,55 @@ type audioPanel struct {
 	sampleRate beep.SampleRate
 	streamer   beep.StreamSeeker
 	ctrl       *beep.Ctrl
+	stretcher  *TimeStretcher
 	resampler  *beep.Resampler
 	loop       *loopBetween
 	volume     *effects.Volume
 	baseRatio  float64
 	speed      float64
+	speedMode  string
 	playing    bool
 }
 
+// Speed modes: resample changes the pitch along with the tempo like a tape machine, stretch
+// keeps the original pitch.
+const (
+	speedModeResample = "resample"
+	speedModeStretch  = "stretch"
+)
+
+func parseSpeedMode(mode string) (string, error) {
+	switch strings.ToLower(mode) {
+	case speedModeResample, "tape":
+		return speedModeResample, nil
+	case speedModeStretch, "pitch":
+		return speedModeStretch, nil
+	}
+	return "", fmt.Errorf("unknown speed mode %q (use resample or stretch)", mode)
+}
+
+// ensureMidiSoundFont loads the soundfont at soundFontPath, again whenever the path changes, as
+// when a session names one.
 func ensureMidiSoundFont() (*midi.SoundFont, error) {
-	midiSoundFontOnce.Do(func() {
-		if soundFontPath == "" {
-			midiSoundFontErr = fmt.Errorf("no soundfont configured; re-run with --soundfont to load MIDI files")
-			return
-		}
-		f, err := os.Open(soundFontPath)
-		if err != nil {
-			midiSoundFontErr = fmt.Errorf("failed to open soundfont: %w", err)
-			return
-		}
-		defer f.Close()
-		midiSoundFont, midiSoundFontErr = midi.NewSoundFont(f)
-	})
+	midiSoundFontMu.Lock()
+	defer midiSoundFontMu.Unlock()
+	loaded := midiSoundFont != nil || midiSoundFontErr != nil
+	if loaded && midiSoundFontPath == soundFontPath {
+		return midiSoundFont, midiSoundFontErr
+	}
+	midiSoundFontPath = soundFontPath
+	midiSoundFont, midiSoundFontErr = nil, nil
+	if soundFontPath == "" {
+		midiSoundFontErr = fmt.Errorf("no soundfont configured; re-run with --soundfont to load MIDI files")
+		return nil, midiSoundFontErr
+	}
+	f, err := os.Open(soundFontPath)
+	if err != nil {
+		midiSoundFontErr = fmt.Errorf("failed to open soundfont: %w", err)
+		return nil, midiSoundFontErr
+	}
+	defer f.Close()
+	midiSoundFont, midiSoundFontErr = midi.NewSoundFont(f)
 	return midiSoundFont, midiSoundFontErr
 }
 
@@ -62,24 +85,56 @@ var listTracksCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all loaded tracks",
 	Run: func(cmd *cobra.Command, args []string) {
-		if ap == nil {
-			fmt.Println("No audio loaded!")
-			return
-		}
-		mts, ok := ap.streamer.(*MultiTrackSeeker)
-		if !ok {
-			fmt.Println("Current streamer is not a MultiTrackSeeker")
+		mts := requireMultiTrack()
+		if mts == nil {
 			return
 		}
 		for _, t := range mts.Tracks {
 			durationSec := float64(t.Streamer.Len()) / float64(format.SampleRate)
 			minutes := int(durationSec) / 60
 			seconds := int(durationSec) % 60
-			fmt.Printf("Track %d: %s (length: %02d:%02d, offset: %.2f sec)\n", t.TrackNumber, t.TrackName, minutes, seconds, t.Offset)
+			fmt.Printf("Track %d: %s (length: %02d:%02d, offset: %.2f sec, rate: %s, gain: %+.1f dB, pan: %s%s)%s\n",
+				t.TrackNumber, t.TrackName, minutes, seconds, t.Offset, formatRate(t.SourceRate, format.SampleRate),
+				t.Gain, formatPan(t.Pan), formatFades(t.Fader), trackFlags(t))
 		}
 	},
 }
 
+func formatRate(source, session beep.SampleRate) string {
+	if source == 0 || source == session {
+		return fmt.Sprintf("%d Hz", session)
+	}
+	return fmt.Sprintf("%d Hz resampled to %d Hz", source, session)
+}
+
+func formatPan(pan float64) string {
+	switch {
+	case pan < 0:
+		return fmt.Sprintf("L%.0f", -pan*100)
+	case pan > 0:
+		return fmt.Sprintf("R%.0f", pan*100)
+	}
+	return "C"
+}
+
+func formatFades(f *Fader) string {
+	if f == nil || (f.FadeIn <= 0 && f.FadeOut <= 0) {
+		return ""
+	}
+	return fmt.Sprintf(", fade: in %v out %v %s", f.FadeIn, f.FadeOut, f.Curve)
+}
+
+func trackFlags(t Track) string {
+	flags := ""
+	if t.Mute {
+		flags += " [muted]"
+	}
+	if t.Solo {
+		flags += " [solo]"
+	}
+	return flags
+}
+
 var dropCmd = &cobra.Command{
 	Use:   "drop [track number]",
 	Short: "Remove a track from playback using its track number",
@@ -90,13 +145,8 @@ var dropCmd = &cobra.Command{
 			fmt.Printf("Failed to parse track number: %s\n", err)
 			return
 		}
-		if ap == nil {
-			fmt.Println("No audio loaded!")
-			return
-		}
-		mts, ok := ap.streamer.(*MultiTrackSeeker)
-		if !ok {
-			fmt.Println("Current streamer is not a MultiTrackSeeker")
+		mts := requireMultiTrack()
+		if mts == nil {
 			return
 		}
 		indexToRemove := -1
@@ -110,7 +160,11 @@ var dropCmd = &cobra.Command{
 			fmt.Printf("Track number %d not found\n", trackNum)
 			return
 		}
-		if err := mts.RemoveTrack(indexToRemove); err != nil {
+		output.Lock()
+		err = mts.RemoveTrack(indexToRemove)
+		mixChanged()
+		output.Unlock()
+		if err != nil {
 			fmt.Printf("Failed to remove track: %s\n", err)
 			return
 		}
@@ -118,20 +172,147 @@ var dropCmd = &cobra.Command{
 	},
 }
 
+var gainCmd = &cobra.Command{
+	Use:   "gain [track number] [dB]",
+	Short: "Set the gain of a track in dB (0 is unity)",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := requireTrack(args[0])
+		if t == nil {
+			return
+		}
+		gain, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			fmt.Printf("Failed to parse gain: %s\n", err)
+			return
+		}
+		if math.IsNaN(gain) || math.IsInf(gain, 0) {
+			fmt.Println("Gain must be a finite number of dB")
+			return
+		}
+		output.Lock()
+		t.Gain = gain
+		mixChanged()
+		output.Unlock()
+		fmt.Printf("Track %d gain set to %+.1f dB\n", t.TrackNumber, gain)
+	},
+}
+
+var panCmd = &cobra.Command{
+	Use:   "pan [track number] [position]",
+	Short: "Pan a track between -1 (left) and 1 (right)",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := requireTrack(args[0])
+		if t == nil {
+			return
+		}
+		pan, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			fmt.Printf("Failed to parse pan: %s\n", err)
+			return
+		}
+		if math.IsNaN(pan) || pan < -1 || pan > 1 {
+			fmt.Println("Pan must be between -1 and 1")
+			return
+		}
+		output.Lock()
+		t.Pan = pan
+		mixChanged()
+		output.Unlock()
+		fmt.Printf("Track %d panned to %s\n", t.TrackNumber, formatPan(pan))
+	},
+}
+
+// parseOnOff parses the optional on|off argument of a toggle command; without one the
+// toggle flips current.
+func parseOnOff(args []string, current bool) (bool, error) {
+	if len(args) == 0 {
+		return !current, nil
+	}
+	switch strings.ToLower(args[0]) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return current, fmt.Errorf("expected on or off, got %q", args[0])
+}
+
+var muteCmd = &cobra.Command{
+	Use:   "mute [track number] [on|off]",
+	Short: "Toggle, or turn on or off, mute of a track",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := requireTrack(args[0])
+		if t == nil {
+			return
+		}
+		output.Lock()
+		muted, err := parseOnOff(args[1:], t.Mute)
+		if err == nil {
+			t.Mute = muted
+			mixChanged()
+		}
+		output.Unlock()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if muted {
+			fmt.Printf("Track %d muted\n", t.TrackNumber)
+		} else {
+			fmt.Printf("Track %d unmuted\n", t.TrackNumber)
+		}
+	},
+}
+
+var soloCmd = &cobra.Command{
+	Use:   "solo [track number] [on|off]",
+	Short: "Toggle, or turn on or off, solo of a track; while any track is soloed only soloed tracks are heard",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := requireTrack(args[0])
+		if t == nil {
+			return
+		}
+		output.Lock()
+		soloed, err := parseOnOff(args[1:], t.Solo)
+		if err == nil {
+			t.Solo = soloed
+			mixChanged()
+		}
+		output.Unlock()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if soloed {
+			fmt.Printf("Track %d soloed\n", t.TrackNumber)
+		} else {
+			fmt.Printf("Track %d unsoloed\n", t.TrackNumber)
+		}
+	},
+}
+
 func newAudioPanel(sampleRate beep.SampleRate, streamer beep.StreamSeeker) *audioPanel {
 	loop := LoopBetween(-1, 0, streamer.Len(), streamer)
+	loop.onEnd = queue.ended
 	ctrl := &beep.Ctrl{Streamer: loop}
-	resampler := beep.ResampleRatio(4, 1, ctrl)
+	stretcher := NewTimeStretcher(sampleRate, ctrl)
+	resampler := beep.ResampleRatio(4, 1, stretcher)
 	volume := &effects.Volume{Streamer: resampler, Base: 2}
 	ap := &audioPanel{
 		sampleRate: sampleRate,
 		streamer:   streamer,
 		ctrl:       ctrl,
+		stretcher:  stretcher,
 		resampler:  resampler,
 		loop:       loop,
 		volume:     volume,
 		baseRatio:  float64(sampleRate) / float64(defaultSampleRate),
 		speed:      1.0,
+		speedMode:  speedModeStretch,
 	}
 	ap.updateResampleRatio()
 	return ap
@@ -145,10 +326,19 @@ func (ap *audioPanel) play() {
 		return
 	}
 	ap.playing = true
-	speaker.Play(ap.volume)
+	output.Play(ap.volume)
 }
 
-func (ap *audioPanel) updateResampleRatio() {
+func (ap *audioPanel) volumePercent() float64 {
+	return math.Pow(ap.volume.Base, ap.volume.Volume) * 100
+}
+
+func (ap *audioPanel) setVolumePercent(percent float64) {
+	ap.volume.Volume = math.Log(percent/100) / math.Log(ap.volume.Base)
+}
+
+// playbackRatio returns how many session samples are played per output sample.
+func (ap *audioPanel) playbackRatio() float64 {
 	target := ap.baseRatio * ap.speed
 	if target <= 0 {
 		target = ap.baseRatio
@@ -156,12 +346,42 @@ func (ap *audioPanel) updateResampleRatio() {
 			target = 1
 		}
 	}
-	ap.resampler.SetRatio(target)
+	return target
+}
+
+// applySpeed configures a stretcher and resampler pair for the current speed and speed mode.
+// At normal speed the stretcher is bypassed so the audio passes through untouched.
+func (ap *audioPanel) applySpeed(stretcher *TimeStretcher, resampler *beep.Resampler) {
+	if ap.speedMode == speedModeStretch && ap.speed > 0 && ap.speed != 1 {
+		stretcher.SetBypass(false)
+		stretcher.SetRatio(ap.speed)
+		resampler.SetRatio(ap.playbackRatio() / ap.speed)
+		return
+	}
+	stretcher.SetBypass(true)
+	resampler.SetRatio(ap.playbackRatio())
+}
+
+// seek moves the playhead of the session to pos and drops what the stretcher buffered from
+// before it. It must be called with the output locked.
+func (ap *audioPanel) seek(pos int) error {
+	if err := ap.streamer.Seek(pos); err != nil {
+		return err
+	}
+	ap.stretcher.Reset()
+	return nil
+}
+
+func (ap *audioPanel) updateResampleRatio() {
+	ap.applySpeed(ap.stretcher, ap.resampler)
 }
 
 func (ap *audioPanel) setSpeed(multiplier float64) {
 	ap.speed = multiplier
 	ap.updateResampleRatio()
+	if mts, ok := ap.streamer.(*MultiTrackSeeker); ok {
+		mts.SetSpeed(multiplier)
+	}
 }
 
 func requireAudioLoaded() bool {
@@ -172,23 +392,199 @@ func requireAudioLoaded() bool {
 	return true
 }
 
+// requireMultiTrack returns the loaded MultiTrackSeeker, printing a message and returning nil if there is none.
+func requireMultiTrack() *MultiTrackSeeker {
+	if !requireAudioLoaded() {
+		return nil
+	}
+	mts, ok := ap.streamer.(*MultiTrackSeeker)
+	if !ok {
+		fmt.Println("Current streamer is not a MultiTrackSeeker")
+		return nil
+	}
+	return mts
+}
+
+// requireTrack looks up a track by its track number argument, printing a message and returning nil on failure.
+func requireTrack(arg string) *Track {
+	trackNum, err := strconv.Atoi(arg)
+	if err != nil {
+		fmt.Printf("Failed to parse track number: %s\n", err)
+		return nil
+	}
+	mts := requireMultiTrack()
+	if mts == nil {
+		return nil
+	}
+	t, err := mts.TrackByNumber(trackNum)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return t
+}
+
 var ap *audioPanel
 
+var (
+	saveStemsDir string
+	saveWAV      wavOptions
+)
+
+var (
+	loadFadeIn    time.Duration
+	loadFadeOut   time.Duration
+	loadFadeCurve string
+	loadStack     bool
+	loadRecursive bool
+)
+
+// openFile opens a music file, with a friendly error if it does not exist.
+func openFile(file string) (*os.File, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, fmt.Errorf("file %s does not exist", file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", file, err)
+	}
+	return f, nil
+}
+
+// decodeFile opens and decodes a supported music file into a seekable stream.
+func decodeFile(file string) (beep.StreamSeeker, beep.Format, error) {
+	f, err := openFile(file)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	head, start, err := readHead(f)
+	if err != nil {
+		f.Close()
+		return nil, beep.Format{}, fmt.Errorf("failed to read file %s: %w", file, err)
+	}
+	d, err := detectDecoder(file, head)
+	if err != nil {
+		f.Close()
+		return nil, beep.Format{}, err
+	}
+	r, err := audioFrom(f, start)
+	if err != nil {
+		f.Close()
+		return nil, beep.Format{}, fmt.Errorf("failed to read file %s: %w", file, err)
+	}
+	streamer, decodedFormat, err := d.decode(r)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("failed to decode file %s: %w", file, err)
+	}
+	return streamer, decodedFormat, nil
+}
+
+// addFileTrack decodes file and adds it to mts at the given offset in seconds. A nil mts starts
+// a new MultiTrackSeeker whose format is taken from the file; the global format only follows it
+// once the session is played, so a failed load leaves the playing one alone. The returned track
+// must be used before more tracks are added.
+func addFileTrack(mts *MultiTrackSeeker, file string, offset float64) (*MultiTrackSeeker, *Track, error) {
+	streamer, decodedFormat, err := decodeFile(file)
+	if err != nil {
+		return mts, nil, err
+	}
+	// initialize MultiTrackSeeker if not already present
+	if mts == nil {
+		mts = NewMultiTrackSeeker([]beep.StreamSeeker{}, decodedFormat)
+	}
+	output.Lock()
+	trackNum := mts.AddTrackWithOffset(streamer, decodedFormat, file, offset)
+	t, err := mts.TrackByNumber(trackNum)
+	mixChanged()
+	output.Unlock()
+	if err == nil && mts.pitch != 0 {
+		err = applyTrackPitch(mts, t, mts.pitch)
+	}
+	return mts, t, err
+}
+
+// ensureAudioPanel creates the audio panel and default markers for a freshly loaded session.
+func ensureAudioPanel(mts *MultiTrackSeeker) {
+	if ap != nil || mts == nil {
+		return
+	}
+	format = mts.format
+	ap = newAudioPanel(format.SampleRate, mts)
+	resetMarkers(mts)
+}
+
+// resetMarkers replaces the markers with the default start and end markers of mts.
+func resetMarkers(mts *MultiTrackSeeker) {
+	Markers = make([]PlaybackPosition, 10)
+	Markers[0] = newMarker(0, "start")
+	Markers[9] = newMarker(mts.Len()-1, "end")
+}
+
+// closeSession stops playback and forgets the loaded session so a new one can take its place.
+func closeSession() {
+	if ap == nil {
+		return
+	}
+	output.Clear()
+	if mts, ok := ap.streamer.(*MultiTrackSeeker); ok {
+		mts.Close()
+	}
+	if queue.next != nil {
+		queue.next.Close()
+		queue.next = nil
+	}
+	queue.current = -1
+	pinkPlaying = false
+	trainer = nil
+	tempo = nil
+	ap = nil
+	Markers = nil
+}
+
 var loadCmd = &cobra.Command{
 	Use:   "load [file...]",
 	Short: "load one or more music files",
-	Long:  `load one or more music files. Each file must be in either mp3, flac, wav, or ogg format.`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `load one or more music files. Each file must be in either mp3, flac, wav, ogg or MIDI format,
+which is recognized from the content of the file, or from its extension if that fails.
+Playlist files (M3U/M3U8, PLS, XSPF), directories and patterns like "**/*.flac" (** matches any
+number of directories) add their files to the queue, sorted by track number tags or naturally by
+name; with --stack the files are loaded as tracks of the session instead. Directories are only
+searched recursively with --recursive.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeFiles,
 	Run: func(cmd *cobra.Command, args []string) {
+		fadeCurve, err := parseFadeCurve(loadFadeCurve)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		args, enqueued, err := expandLoadArgs(args, loadStack, loadRecursive)
+		if err != nil {
+			fmt.Printf("Failed to load: %s\n", err)
+			return
+		}
+		if enqueued > 0 {
+			fmt.Printf("Added %d entries to the queue (%d in total)\n", enqueued, len(queue.entries))
+			if len(args) == 0 {
+				if ap == nil {
+					if err := queue.skip(1); err != nil {
+						fmt.Println(err)
+					}
+				} else {
+					queue.readAhead()
+				}
+				return
+			}
+		}
 		var mts *MultiTrackSeeker
-		var initFormat beep.Format
 		// if an audio panel is already active, reuse its MultiTrackSeeker
 		if ap != nil {
 			if existing, ok := ap.streamer.(*MultiTrackSeeker); ok {
 				mts = existing
-				initFormat = format
 			}
 		}
+		newSession := mts == nil
+		var embedded wavMarkers
 		// iterate over provided arguments: if an argument is a float, it
 		// represents an offset for the next filename; otherwise load with offset 0.
 		for i := 0; i < len(args); {
@@ -207,69 +603,29 @@ var loadCmd = &cobra.Command{
 				file = args[i]
 				i++
 			}
-			if _, err := os.Stat(file); os.IsNotExist(err) {
-				fmt.Printf("File %s does not exist\n", file)
-				return
-			}
-			f, err := os.Open(file)
+			var t *Track
+			mts, t, err = addFileTrack(mts, file, offset)
 			if err != nil {
-				fmt.Printf("Failed to open file %s: %s\n", file, err)
-				return
-			}
-			var streamer beep.StreamSeeker
-			var decodedFormat beep.Format
-			switch {
-			case strings.HasSuffix(file, ".mp3"):
-				streamer, decodedFormat, err = mp3.Decode(f)
-			case strings.HasSuffix(file, ".wav"):
-				streamer, decodedFormat, err = wav.Decode(f)
-			case strings.HasSuffix(file, ".flac"):
-				streamer, decodedFormat, err = flac.Decode(f)
-			case strings.HasSuffix(file, ".ogg"):
-				streamer, decodedFormat, err = vorbis.Decode(f)
-			case strings.HasSuffix(file, ".mid") || strings.HasSuffix(file, ".midi"):
-				var sf *midi.SoundFont
-				sf, err = ensureMidiSoundFont()
-				if err != nil {
-					fmt.Printf("Failed to load MIDI soundfont: %s\n", err)
-					return
+				fmt.Printf("Failed to load file: %s\n", err)
+				if newSession && mts != nil {
+					mts.Close()
 				}
-				var midiStream beep.StreamSeeker
-				midiStream, decodedFormat, err = midi.Decode(f, sf, defaultSampleRate)
-				if err == nil {
-					buffer := beep.NewBuffer(decodedFormat)
-					buffer.Append(midiStream)
-					streamer = buffer.Streamer(0, buffer.Len())
-				}
-			default:
-				fmt.Printf("Unsupported file format: %s\n", file)
 				return
 			}
-			if err != nil {
-				fmt.Printf("Failed to decode file %s: %s\n", file, err)
-				return
-			}
-			// initialize MultiTrackSeeker if not already present
-			if mts == nil {
-				initFormat = decodedFormat
-				format = decodedFormat
-				mts = NewMultiTrackSeeker([]beep.StreamSeeker{}, initFormat)
-			}
-			trackNum := mts.AddTrackWithOffset(streamer, file, offset)
-			fmt.Printf("Loaded file: %s as track %d with offset %.2f\n", file, trackNum, offset)
-		}
-		if ap == nil {
-			ap = newAudioPanel(initFormat.SampleRate, mts)
-			Markers = make([]PlaybackPosition, 10)
-			Markers[0] = PlaybackPosition{
-				SamplePosition: 0,
-				PlayPosition:   0.0,
-			}
-			Markers[9] = PlaybackPosition{
-				SamplePosition: mts.Len() - 1,
-				PlayPosition:   initFormat.SampleRate.D(mts.Len() - 1).Seconds(),
+			output.Lock()
+			t.Fader.FadeIn = loadFadeIn
+			t.Fader.FadeOut = loadFadeOut
+			t.Fader.Curve = fadeCurve
+			mixChanged()
+			output.Unlock()
+			fmt.Printf("Loaded file: %s as track %d with offset %.2f\n", file, t.TrackNumber, offset)
+			if isFormat(file, "wav") {
+				collectWAVMarkers(&embedded, file, offset)
 			}
 		}
+		ensureAudioPanel(mts)
+		applyWAVMarkers(embedded, newSession)
+		loadMarkerSidecar()
 		return
 	},
 }
@@ -284,12 +640,12 @@ var pauseCmd = &cobra.Command{
 			return
 		}
 		// pause/resume playback
-		speaker.Lock()
+		output.Lock()
 		ap.ctrl.Paused = !ap.ctrl.Paused
 		position := ap.sampleRate.D(ap.streamer.Position())
 		length := ap.sampleRate.D(ap.streamer.Len())
 		volume := ap.volume.Volume
-		speaker.Unlock()
+		output.Unlock()
 		positionStatus := fmt.Sprintf("%v / %v", position.Round(time.Second), length.Round(time.Second))
 		volumeStatus := fmt.Sprintf("%.1f", volume)
 		fmt.Println(positionStatus, volumeStatus)
@@ -361,133 +717,259 @@ var volumeCmd = &cobra.Command{
 			fmt.Println("Volume must be between 0 and 100")
 			return
 		}
-		speaker.Lock()
-		ap.volume.Volume = math.Log(float64(vol)/100) / math.Log(ap.volume.Base)
-		speaker.Unlock()
+		output.Lock()
+		ap.setVolumePercent(float64(vol))
+		output.Unlock()
 		fmt.Printf("Volume set to %d%%\n", vol)
 	},
 }
 
+var setMarkerAt string
+
 var setMarkerCmd = &cobra.Command{
-	Use:     "setmarker [marker]",
+	Use:     "setmarker [marker] [label]",
 	Aliases: []string{"m"},
-	Short:   "Set a marker",
-	Args:    cobra.ExactArgs(1),
+	Short:   "Set a marker at the playhead, optionally with a label",
+	Long: `Set a marker at the current playback position. The marker is given by index (0-9 map to the
+digit keys) or by label; an unknown label takes the first free index. An optional second argument
+labels the marker, e.g. setmarker 3 "chorus". --at sets it elsewhere: at a time (1:23.5, +2s from
+the playhead), another marker or a bar (b17:1).`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeMarkerArgs(1, false),
 	Run: func(cmd *cobra.Command, args []string) {
 		if !requireAudioLoaded() {
 			return
 		}
 		index, err := strconv.Atoi(args[0])
+		label := ""
 		if err != nil {
-			fmt.Printf("Failed to parse argument: %s\n", err)
+			// not an index: reuse the marker with that label or pick a free slot for it
+			label = args[0]
+			if index, err = resolveMarker(label); err != nil {
+				index = freeMarkerIndex()
+			}
+		} else if index < 0 {
+			fmt.Printf("Invalid marker index %d\n", index)
 			return
+		} else if index < len(Markers) {
+			label = Markers[index].Label
+		}
+		if len(args) > 1 {
+			label = args[1]
 		}
 
-		speaker.Lock()
+		output.Lock()
 		samplePosition := ap.streamer.Position()
-		playPosition := ap.sampleRate.D(samplePosition).Seconds()
-		speaker.Unlock()
-
-		newMarker := PlaybackPosition{
-			SamplePosition: samplePosition,
-			PlayPosition:   playPosition,
+		output.Unlock()
+		if setMarkerAt != "" {
+			if samplePosition, _, err = parsePosition(setMarkerAt, samplePosition); err != nil {
+				fmt.Println(err)
+				return
+			}
 		}
 
 		for len(Markers) <= index {
 			Markers = append(Markers, PlaybackPosition{})
 		}
-		Markers[index] = newMarker
+		Markers[index] = newMarker(samplePosition, label)
+		saveMarkerSidecar()
 
-		fmt.Printf("Marker %d set to sample position %d (play position %.2f seconds)\n", index, samplePosition, playPosition)
+		at := ""
+		if tempo != nil {
+			at = ", bar " + tempo.format(samplePosition)
+		}
+		fmt.Printf("Marker %s set to sample position %d (play position %.2f seconds%s)\n", markerName(index), samplePosition, Markers[index].PlayPosition, at)
 	},
 }
 
 var gotoCmd = &cobra.Command{
-	Use:   "goto [marker]",
-	Short: "Go to a marker",
-	Args:  cobra.ExactArgs(1),
+	Use:               "goto [position]",
+	Short:             "Go to a marker by index or label, a time (1:23.5, +8s) or a bar (b17:3)",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeMarkerArgs(1, false),
 	Run: func(cmd *cobra.Command, args []string) {
 		if !requireAudioLoaded() {
 			return
 		}
-		markerIndex, err := strconv.Atoi(args[0])
+		output.Lock()
+		playhead := ap.streamer.Position()
+		output.Unlock()
+		pos, desc, err := parsePosition(args[0], playhead)
 		if err != nil {
-			fmt.Printf("Failed to parse argument: %s\n", err)
-			return
-		}
-		if markerIndex < 0 || markerIndex >= len(Markers) {
-			fmt.Printf("Marker %d does not exist\n", markerIndex)
+			fmt.Println(err)
 			return
 		}
-		marker := Markers[markerIndex]
-		if err := ap.streamer.Seek(marker.SamplePosition); err != nil {
+		output.Lock()
+		err = ap.seek(pos)
+		output.Unlock()
+		if err != nil {
 			fmt.Println(err)
 			return
 		}
-		playPos := ap.sampleRate.D(marker.SamplePosition).Seconds()
-		fmt.Printf("Jumped to marker %d (play position: %.2f sec)\n", markerIndex, playPos)
+		playPos := ap.sampleRate.D(pos).Seconds()
+		fmt.Printf("Jumped to %s (play position: %.2f sec)\n", desc, playPos)
 	},
 }
 
+var (
+	loopXFade time.Duration
+	loopSnap  bool
+	loopTimes int
+	loopThen  string
+)
+
+// loopSnapWindow is how far loop points may move to reach a zero crossing.
+const loopSnapWindow = 5 * time.Millisecond
+
 var loopCmd = &cobra.Command{
-	Use:   "loop [start_marker] [end_marker]",
-	Short: "Loop between two markers",
-	Args:  cobra.ExactArgs(2),
+	Use:   "loop [start] [end]",
+	Short: "Loop between two markers or times (1:23.5, 83.5s), over a region marker, or for +8s from the playhead",
+	Long: `Loop between two positions or over a region marker. A position is a marker index or label,
+a time like 1:23.5 or 83.5s, or a time relative to the playhead like +8s; a relative end such as
++4s counts from the start, and a single relative time loops from the playhead, e.g. loop +8s.
+--xfade 20ms blends the end of the loop into its start instead of jumping, which removes the click
+at the loop point; it stays in effect for later loops until set to 0. --snap moves both loop points
+to the nearest zero crossing within 5ms.
+--times N jumps to the loop start and plays the loop N times; --then decides what follows:
+continue (the default) plays on past the loop, pause pauses at its end and stop pauses and returns
+to the loop start, ready for another N repetitions.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeMarkerArgs(2, false),
 	Run: func(cmd *cobra.Command, args []string) {
 		if !requireAudioLoaded() {
 			return
 		}
-		startMarker, err := strconv.Atoi(args[0])
+		startPos, endPos, desc, err := markerRange(args)
 		if err != nil {
-			fmt.Printf("Failed to parse start_marker argument: %s\n", err)
+			fmt.Println(err)
 			return
 		}
-		endMarker, err := strconv.Atoi(args[1])
-		if err != nil {
-			fmt.Printf("Failed to parse end_marker argument: %s\n", err)
+		if loopXFade < 0 {
+			fmt.Println("Crossfade length must not be negative")
+			return
+		}
+		if loopTimes < 0 {
+			fmt.Println("Number of repetitions must not be negative")
 			return
 		}
-		fmt.Printf("Loop between markers %d and %d\n", startMarker, endMarker)
-		startPos := Markers[startMarker].SamplePosition
-		endPos := Markers[endMarker].SamplePosition
-		speaker.Lock()
+		switch loopThen {
+		case "continue", "pause", "stop":
+		default:
+			fmt.Printf("Unknown --then %q (use continue, pause or stop)\n", loopThen)
+			return
+		}
+		output.Lock()
+		if loopSnap {
+			window := ap.sampleRate.N(loopSnapWindow)
+			startPos = snapToZeroCrossing(ap.streamer, startPos, window)
+			endPos = snapToZeroCrossing(ap.streamer, endPos, window)
+			// both points may move to the same crossing in a short loop
+			if startPos >= endPos {
+				output.Unlock()
+				fmt.Println("start position must be before end position after snapping to zero crossings")
+				return
+			}
+		}
 		ap.loop.start = startPos
 		ap.loop.end = endPos
-		speaker.Unlock()
+		if cmd.Flags().Changed("xfade") {
+			ap.loop.xfade = ap.sampleRate.N(loopXFade)
+		}
+		xfade := ap.loop.xfade
+		ap.loop.remains = -1
+		ap.loop.times = loopTimes
+		ap.loop.then = loopThen
+		ap.loop.onDone = nil
+		if loopTimes > 0 {
+			ap.loop.remains = loopTimes
+			ap.loop.onDone = ap.finishLoop
+			err = ap.seek(startPos)
+		}
+		output.Unlock()
+		if err != nil {
+			fmt.Printf("Failed to seek to loop start: %s\n", err)
+			return
+		}
+		if loopSnap {
+			desc += " (snapped to zero crossings)"
+		}
+		if xfade > 0 {
+			desc += fmt.Sprintf(" with a %v crossfade", ap.sampleRate.D(xfade).Round(time.Millisecond))
+		}
+		if loopTimes > 0 {
+			desc += fmt.Sprintf(", %d times, then %s", loopTimes, loopThen)
+		}
+		fmt.Printf("Loop between %s\n", desc)
+		saveMarkerSidecar()
+	},
+}
+
+var unloopCmd = &cobra.Command{
+	Use:   "unloop",
+	Short: "Stop looping and play the whole session again",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireAudioLoaded() {
+			return
+		}
+		output.Lock()
+		ap.loop.unloop()
+		stopped := stopTrainer()
+		output.Unlock()
+		if stopped {
+			fmt.Println("Speed trainer stopped")
+		}
+		fmt.Println("Loop cleared, playing the whole session")
+		saveMarkerSidecar()
 	},
 }
 
 var saveCmd = &cobra.Command{
 	Use:   "save [start_marker] [end_marker] [output_file]",
 	Short: "Save the loop between two markers to a file",
-	Long:  `Save the audio loop between two specified markers to a .wav file.`,
-	Args:  cobra.ExactArgs(3),
+	Long: `Save the audio loop between two specified markers to a .wav file.
+Instead of two markers a single region marker can be given, e.g. save chorus chorus.wav.
+With --stems <dir> every track is written to its own file in dir instead, and no output file is given.`,
+	Args:              cobra.RangeArgs(1, 3),
+	ValidArgsFunction: completeMarkerArgs(2, true),
 	Run: func(cmd *cobra.Command, args []string) {
 		if !requireAudioLoaded() {
 			return
 		}
-		startMarker, err := strconv.Atoi(args[0])
+		opts, err := saveWAV.resolve(format)
 		if err != nil {
-			fmt.Printf("Failed to parse start_marker argument: %s\n", err)
+			fmt.Println(err)
 			return
 		}
-		endMarker, err := strconv.Atoi(args[1])
-		if err != nil {
-			fmt.Printf("Failed to parse end_marker argument: %s\n", err)
+		if saveStemsDir != "" {
+			mts := requireMultiTrack()
+			if mts == nil {
+				return
+			}
+			startPos, endPos, desc, err := markerRange(args)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			files, err := saveStems(mts, saveStemsDir, startPos, endPos, opts)
+			for _, file := range files {
+				fmt.Printf("Saved stem %s\n", file)
+			}
+			if err != nil {
+				fmt.Printf("Failed to save stems: %s\n", err)
+				return
+			}
+			fmt.Printf("Saved %d stems of %s to %s\n", len(files), segmentName(desc), saveStemsDir)
 			return
 		}
-		outputFile := args[2]
-
-		if startMarker < 0 || startMarker >= len(Markers) || endMarker < 0 || endMarker >= len(Markers) {
-			fmt.Println("Invalid marker indices")
+		if len(args) < 2 {
+			fmt.Println("Expected markers and an output file")
 			return
 		}
-
-		startPos := Markers[startMarker].SamplePosition
-		endPos := Markers[endMarker].SamplePosition
-
-		if startPos >= endPos {
-			fmt.Println("Start marker must be before end marker")
+		outputFile := args[len(args)-1]
+		startPos, endPos, desc, err := markerRange(args[:len(args)-1])
+		if err != nil {
+			fmt.Println(err)
 			return
 		}
 
@@ -499,8 +981,21 @@ var saveCmd = &cobra.Command{
 		}
 		defer f.Close()
 
+		// The export is written at 1x, so fades must span their nominal length
+		// regardless of the current playback speed. Hold the output lock while
+		// reading so playback does not consume samples from the segment.
+		output.Lock()
+		resumePos := ap.streamer.Position()
+		mts, isMulti := ap.streamer.(*MultiTrackSeeker)
+		if isMulti {
+			mts.SetSpeed(1)
+		}
 		// Seek to the start position
 		if err := ap.streamer.Seek(startPos); err != nil {
+			if isMulti {
+				mts.SetSpeed(ap.speed)
+			}
+			output.Unlock()
 			fmt.Printf("Failed to seek to start position: %s\n", err)
 			return
 		}
@@ -509,29 +1004,67 @@ var saveCmd = &cobra.Command{
 		buffer := beep.NewBuffer(format)
 		segment := beep.Take(endPos-startPos, ap.streamer)
 		buffer.Append(segment)
+		if isMulti {
+			mts.SetSpeed(ap.speed)
+		}
+		resumeErr := ap.streamer.Seek(resumePos)
+		output.Unlock()
+		if resumeErr != nil {
+			// the segment is in the buffer, so it is still written
+			fmt.Printf("Failed to return to the playback position: %s\n", resumeErr)
+		}
 
 		// Create a streamer from the buffer
 		streamer := buffer.Streamer(0, buffer.Len())
 
 		// Encode the streamer to a wav file
-		if err := wav.Encode(f, streamer, format); err != nil {
+		// Markers and the loop inside the segment travel with it as cue and smpl chunks.
+		scale := float64(opts.SampleRate) / float64(format.SampleRate)
+		chunks := wavMarkerChunks(startPos, endPos, scale, opts.SampleRate)
+		if err := encodeWAV(f, streamer, format.SampleRate, opts, chunks...); err != nil {
 			fmt.Printf("Failed to encode wav file: %s\n", err)
 			return
 		}
 
-		fmt.Printf("Saved segment between markers %d and %d to %s\n", startMarker, endMarker, outputFile)
+		fmt.Printf("Saved %s to %s (%s)\n", segmentName(desc), outputFile, opts.describe())
 	},
 }
 
+// segmentName names a range described by markerRange in messages, e.g. "region 3" or
+// "segment between 0:01.000 and 0:02.000".
+func segmentName(desc string) string {
+	if strings.HasPrefix(desc, "region ") {
+		return desc
+	}
+	return "segment between " + desc
+}
+
 func init() {
-	RootCmd.AddCommand(loadCmd, pauseCmd, rewindCmd, forwardCmd, volumeCmd, setMarkerCmd, gotoCmd, loopCmd, saveCmd, speedCmd)
+	loadCmd.Flags().DurationVar(&loadFadeIn, "fade-in", 0, "fade-in duration applied to each loaded track (e.g. 2s)")
+	loadCmd.Flags().DurationVar(&loadFadeOut, "fade-out", 0, "fade-out duration applied to each loaded track (e.g. 1.5s)")
+	loadCmd.Flags().StringVar(&loadFadeCurve, "fade-curve", "linear", "fade curve: linear, exponential or equal-power")
+	loadCmd.Flags().BoolVar(&loadStack, "stack", false, "load the files of playlists, directories and patterns as tracks instead of adding them to the queue")
+	loadCmd.Flags().BoolVarP(&loadRecursive, "recursive", "r", false, "load the files in subdirectories of directories too")
+	saveCmd.Flags().StringVar(&saveStemsDir, "stems", "", "write one WAV per track into this directory instead of the mix")
+	addWAVFlags(saveCmd.Flags(), &saveWAV)
+	setMarkerCmd.Flags().StringVar(&setMarkerAt, "at", "", "set the marker at this position instead of the playhead, e.g. 1:23.5 or b17:1")
+	loopCmd.Flags().DurationVar(&loopXFade, "xfade", 0, "crossfade the loop end into its start, e.g. 20ms")
+	loopCmd.Flags().BoolVar(&loopSnap, "snap", false, "move the loop points to nearby zero crossings")
+	loopCmd.Flags().IntVar(&loopTimes, "times", 0, "play the loop this many times (default: forever)")
+	loopCmd.Flags().StringVar(&loopThen, "then", "continue", "after the last repetition: continue, pause or stop")
+	speedCmd.Flags().StringVar(&speedMode, "mode", "", "resample (pitch follows speed) or stretch (pitch is kept)")
+	RootCmd.AddCommand(loadCmd, pauseCmd, rewindCmd, forwardCmd, volumeCmd, setMarkerCmd, gotoCmd, loopCmd, unloopCmd, saveCmd, speedCmd)
 	RootCmd.AddCommand(posCmd, loopStatusCmd, speedCmd, listTracksCmd, dropCmd)
+	RootCmd.AddCommand(gainCmd, panCmd, muteCmd, soloCmd)
+	allowNegativeArgs(gainCmd, panCmd)
 }
 
 func seekPos(pos float64) {
 	if !requireAudioLoaded() {
 		return
 	}
+	output.Lock()
+	defer output.Unlock()
 	newPos := ap.streamer.Position()
 	// move this by the passed float seconds
 	newPos += ap.sampleRate.N(time.Duration(pos) * time.Second)
@@ -541,15 +1074,23 @@ func seekPos(pos float64) {
 	if newPos >= ap.streamer.Len() {
 		newPos = ap.streamer.Len() - 1
 	}
-	if err := ap.streamer.Seek(newPos); err != nil {
+	if err := ap.seek(newPos); err != nil {
 		fmt.Println(err)
 	}
 
 }
 
 type PlaybackPosition struct {
-	SamplePosition int
-	PlayPosition   float64
+	SamplePosition int     `json:"sample"`
+	PlayPosition   float64 `json:"seconds"`
+	Label          string  `json:"label,omitempty"`
+	Set            bool    `json:"set"`
+	EndPosition    int     `json:"end,omitempty"` // end sample of a region marker, 0 for a point marker
+}
+
+// IsRegion reports whether the marker spans a range rather than a single position.
+func (p PlaybackPosition) IsRegion() bool {
+	return p.EndPosition > p.SamplePosition
 }
 
 // LoopBetween takes a StreamSeeker and plays it between start and end positions. If count is negative, s is looped infinitely.
@@ -565,10 +1106,20 @@ func LoopBetween(count int, start int, end int, s beep.StreamSeeker) *loopBetwee
 }
 
 type loopBetween struct {
-	s       beep.StreamSeeker
-	remains int
-	start   int
-	end     int
+	s        beep.StreamSeeker
+	remains  int
+	start    int
+	end      int
+	xfade    int               // crossfade length in samples, 0 for a hard jump
+	head     [][2]float64      // the first xfade samples after start, read for the crossfade
+	headAt   int               // loop start head was read from, -1 for the head of next
+	onWrap   func()            // called while the output is streaming, each time playback jumps back to start
+	onDone   func() bool       // called instead of ending the stream when remains runs out; false fills the rest with silence
+	onEnd    func() bool       // called at the end of the whole stream instead of looping; true fills the rest with silence
+	next     beep.StreamSeeker // the queue entry that follows the whole stream, blended in instead of the head
+	nextHead [][2]float64      // the first samples of next, read ahead for the crossfade into it
+	times    int               // repetitions requested with loop --times, 0 when looping forever
+	then     string            // what happens after the last repetition: continue, pause or stop
 }
 
 func (l *loopBetween) Stream(samples [][2]float64) (n int, ok bool) {
@@ -576,26 +1127,112 @@ func (l *loopBetween) Stream(samples [][2]float64) (n int, ok bool) {
 		return 0, false
 	}
 	for len(samples) > 0 {
-		sn, sok := l.s.Stream(samples)
-		if !sok || l.s.Position() >= l.end {
-			if l.remains > 0 {
-				l.remains--
+		pos := l.s.Position()
+		x := l.crossfadeLen()
+		if l.remains == 1 {
+			// the last pass plays through to the end instead of blending into the head
+			x = 0
+		}
+		fadeStart := l.end - x
+		faded := false
+		if pos < l.end {
+			// Stop exactly at the loop end, or at the start of the crossfade region so the
+			// head can be blended in sample by sample.
+			chunk := samples[:min(len(samples), l.end-pos)]
+			if pos < fadeStart {
+				chunk = samples[:min(len(samples), fadeStart-pos)]
+			} else if x > 0 && l.headStale(x) {
+				l.readHead(x, pos)
+			}
+			sn, sok := l.s.Stream(chunk)
+			if pos >= fadeStart && len(l.head) == x {
+				l.blendHead(chunk[:sn], pos-fadeStart)
+				faded = x > 0 && pos+sn >= l.end
 			}
-			if l.remains == 0 {
+			samples = samples[sn:]
+			n += sn
+			if sok && sn > 0 && pos+sn < l.end {
+				continue
+			}
+		}
+		if l.onEnd != nil && l.wholeStream() && l.onEnd() {
+			clear(samples)
+			n += len(samples)
+			break
+		}
+		if l.remains > 0 {
+			l.remains--
+		}
+		if l.remains == 0 {
+			if l.onDone == nil {
 				break
 			}
-			err := l.s.Seek(l.start)
-			if err != nil {
-				return n, true
+			if !l.onDone() {
+				clear(samples)
+				n += len(samples)
+				break
 			}
 			continue
 		}
-		samples = samples[sn:]
-		n += sn
+		// after a crossfade the head has already been heard
+		target := l.start
+		if faded {
+			target += x
+		}
+		err := l.s.Seek(target)
+		if err != nil {
+			return n, true
+		}
+		if l.onWrap != nil {
+			l.onWrap()
+		}
 	}
 	return n, true
 }
 
+// wholeStream reports whether the loop is plain playback of the whole stream, as after unloop.
+func (l *loopBetween) wholeStream() bool {
+	return l.start == 0 && l.end >= l.s.Len() && l.times == 0
+}
+
+// unloop makes the loop span the whole stream and repeat forever, i.e. plain playback.
+func (l *loopBetween) unloop() {
+	l.start = 0
+	l.end = l.s.Len()
+	l.remains = -1
+	l.times = 0
+	l.onDone = nil
+}
+
+// finishLoop runs after the last repetition of a loop --times loop. It is called while the
+// output is streaming and returns whether playback goes on.
+func (ap *audioPanel) finishLoop() bool {
+	l := ap.loop
+	switch l.then {
+	case "pause":
+		// stay at the loop end; resuming plays on from there
+		l.unloop()
+		ap.ctrl.Paused = true
+		return false
+	case "stop":
+		// back to the loop start, ready to drill the same number of repetitions again; the seek
+		// resets the stretcher that is streaming right now, so it happens outside of the audio thread
+		l.remains = l.times
+		ap.ctrl.Paused = true
+		panel := ap
+		go func() {
+			output.Lock()
+			if ap == panel && ap.loop == l {
+				ap.seek(l.start)
+			}
+			output.Unlock()
+		}()
+		return false
+	}
+	l.unloop()
+	return true
+}
+
 func (l *loopBetween) Err() error {
 	return l.s.Err()
 }
@@ -608,24 +1245,42 @@ var loopStatusCmd = &cobra.Command{
 			fmt.Println("No audio loaded!")
 			return
 		}
+		output.Lock()
+		start, end, xfade := ap.loop.start, ap.loop.end, ap.loop.xfade
+		remains, times, then := ap.loop.remains, ap.loop.times, ap.loop.then
+		output.Unlock()
 		// Look for matching marker indices
 		var startMarker, endMarker string
 		for i, marker := range Markers {
-			if marker.SamplePosition == ap.loop.start {
-				startMarker = strconv.Itoa(i)
+			if !marker.Set {
+				continue
 			}
-			if marker.SamplePosition == ap.loop.end {
-				endMarker = strconv.Itoa(i)
+			if marker.SamplePosition == start {
+				startMarker = markerName(i)
+			}
+			if marker.SamplePosition == end {
+				endMarker = markerName(i)
 			}
 		}
 		// If no matching markers found, display the playback positions in seconds.
 		if startMarker == "" {
-			startMarker = fmt.Sprintf("%.2f sec", ap.sampleRate.D(ap.loop.start).Seconds())
+			startMarker = fmt.Sprintf("%.2f sec", ap.sampleRate.D(start).Seconds())
 		}
 		if endMarker == "" {
-			endMarker = fmt.Sprintf("%.2f sec", ap.sampleRate.D(ap.loop.end).Seconds())
+			endMarker = fmt.Sprintf("%.2f sec", ap.sampleRate.D(end).Seconds())
 		}
 		fmt.Printf("Currently looping between %s and %s\n", startMarker, endMarker)
+		if xfade > 0 {
+			fmt.Printf("Crossfade: %v\n", ap.sampleRate.D(xfade).Round(time.Millisecond))
+		}
+		if times > 0 {
+			fmt.Printf("Repetition %d of %d, then %s\n", times-remains+1, times, then)
+		}
+		output.Lock()
+		if trainer != nil {
+			fmt.Println(trainer.status())
+		}
+		output.Unlock()
 	},
 }
 
@@ -639,27 +1294,62 @@ var posCmd = &cobra.Command{
 			fmt.Println("No audio loaded!")
 			return
 		}
-		speaker.Lock()
-		position := ap.sampleRate.D(ap.streamer.Position()).Seconds()
+		output.Lock()
+		samplePosition := ap.streamer.Position()
+		position := ap.sampleRate.D(samplePosition).Seconds()
 		length := ap.sampleRate.D(ap.streamer.Len()).Seconds()
 		volume := ap.volume.Volume
-		speaker.Unlock()
-		fmt.Printf("%.3f / %.3f (Volume: %.1f)\n", position, length, volume)
+		output.Unlock()
+		bars := ""
+		if tempo != nil {
+			bars = fmt.Sprintf(" bar %s", tempo.format(samplePosition))
+		}
+		fmt.Printf("%.3f / %.3f%s (Volume: %.1f)\n", position, length, bars, volume)
 	},
 }
+var speedMode string
+
 var speedCmd = &cobra.Command{
 	Use:   "speed [multiplier]",
 	Short: "Set playback speed multiplier (e.g. 0.5 for half speed, 2 for double speed)",
-	Args:  cobra.ExactArgs(1),
+	Long: `Set playback speed multiplier (e.g. 0.5 for half speed, 2 for double speed). Without a
+multiplier the current speed is shown. With --mode stretch (the default) the pitch is kept, with
+--mode resample the pitch follows the speed like a tape machine.`,
+	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
-		newSpeed, err := strconv.ParseFloat(args[0], 64)
-		if err != nil {
-			fmt.Printf("Failed to parse speed multiplier: %s\n", err)
+		if !requireAudioLoaded() {
 			return
 		}
-		speaker.Lock()
+		newSpeed := ap.speed
+		if len(args) > 0 {
+			var err error
+			newSpeed, err = strconv.ParseFloat(args[0], 64)
+			if err != nil {
+				fmt.Printf("Failed to parse speed multiplier: %s\n", err)
+				return
+			}
+			if !(newSpeed > 0) || math.IsInf(newSpeed, 0) {
+				fmt.Println("Speed multiplier must be a finite number greater than 0")
+				return
+			}
+		}
+		mode := ap.speedMode
+		if speedMode != "" {
+			var err error
+			mode, err = parseSpeedMode(speedMode)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		output.Lock()
+		stopped := len(args) > 0 && stopTrainer()
+		ap.speedMode = mode
 		ap.setSpeed(newSpeed)
-		speaker.Unlock()
-		fmt.Printf("Playback speed set to %.2fx\n", newSpeed)
+		output.Unlock()
+		if stopped {
+			fmt.Println("Speed trainer stopped")
+		}
+		fmt.Printf("Playback speed set to %.2fx (%s)\n", newSpeed, mode)
 	},
 }
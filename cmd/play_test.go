@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrackMixCommands(t *testing.T) {
+	mts := newTestSession(t, 1)
+	track := &mts.Tracks[0]
+
+	for _, value := range []string{"NaN", "Inf", "-Inf"} {
+		execute(t, "gain", "1", value)
+		execute(t, "pan", "1", value)
+	}
+	if track.Gain != 0 || track.Pan != 0 {
+		t.Errorf("non-finite values were taken: gain %v, pan %v", track.Gain, track.Pan)
+	}
+	execute(t, "gain", "1", "-6")
+	execute(t, "pan", "1", "-0.5")
+	if track.Gain != -6 || track.Pan != -0.5 {
+		t.Errorf("gain %v, pan %v; want -6, -0.5", track.Gain, track.Pan)
+	}
+
+	tests := []struct {
+		args       []string
+		mute, solo bool
+	}{
+		{[]string{"mute", "1"}, true, false},
+		{[]string{"mute", "1", "on"}, true, false},
+		{[]string{"mute", "1", "OFF"}, false, false},
+		{[]string{"mute", "1", "off"}, false, false},
+		{[]string{"solo", "1", "on"}, false, true},
+		{[]string{"solo", "1", "maybe"}, false, true},
+		{[]string{"solo", "1"}, false, false},
+	}
+	for _, tt := range tests {
+		execute(t, tt.args...)
+		if track.Mute != tt.mute || track.Solo != tt.solo {
+			t.Errorf("%v: mute %v, solo %v; want %v, %v", tt.args, track.Mute, track.Solo, tt.mute, tt.solo)
+		}
+	}
+}
+
+func TestSpeedCommand(t *testing.T) {
+	newTestSession(t, 1)
+	execute(t, "speed", "1.5")
+	for _, value := range []string{"0", "NaN", "Inf", "+Inf"} {
+		execute(t, "speed", value)
+		if ap.speed != 1.5 {
+			t.Errorf("speed %s: speed %v, want it left at 1.5", value, ap.speed)
+		}
+	}
+}
+
+func TestSessionFlagOpensOnce(t *testing.T) {
+	newTestSession(t, 1)
+	execute(t, "--session", filepath.Join(t.TempDir(), "missing.json"))
+	if sessionPath != "" {
+		t.Errorf("--session is still %q after the session was opened", sessionPath)
+	}
+}
+
+func TestSoundFontReloadedOnChange(t *testing.T) {
+	defer func(path string) { soundFontPath = path }(soundFontPath)
+	soundFontPath = ""
+	if _, err := ensureMidiSoundFont(); err == nil || !strings.Contains(err.Error(), "no soundfont configured") {
+		t.Fatalf("without a soundfont: %v", err)
+	}
+	soundFontPath = filepath.Join(t.TempDir(), "missing.sf2")
+	if _, err := ensureMidiSoundFont(); err == nil || !strings.Contains(err.Error(), "failed to open soundfont") {
+		t.Errorf("after the path changed: %v, want the new path to be opened", err)
+	}
+}
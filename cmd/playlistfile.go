@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// playlistEntry is one entry of a playlist file. Duration is in seconds, -1 when unknown.
+type playlistEntry struct {
+	Path     string
+	Title    string
+	Duration float64
+}
+
+func isPlaylistFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".m3u", ".m3u8", ".pls", ".xspf":
+		return true
+	}
+	return false
+}
+
+// readPlaylist reads an M3U/M3U8, PLS or XSPF playlist. Relative paths are resolved against the
+// directory of the playlist; URLs other than file:// are not supported and skipped.
+func readPlaylist(path string) ([]playlistEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var entries []playlistEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pls":
+		entries, err = parsePLS(data)
+	case ".xspf":
+		entries, err = parseXSPF(data)
+	default:
+		entries = parseM3U(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse playlist %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	resolved := entries[:0]
+	for _, e := range entries {
+		p, ok := resolvePlaylistPath(e.Path, dir)
+		if !ok {
+			fmt.Printf("Skipping %s: only local files are supported\n", e.Path)
+			continue
+		}
+		e.Path = p
+		resolved = append(resolved, e)
+	}
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("playlist %s has no entries", path)
+	}
+	return resolved, nil
+}
+
+// resolvePlaylistPath turns an entry location into a local path, relative to dir unless absolute.
+func resolvePlaylistPath(location, dir string) (string, bool) {
+	if u, err := url.Parse(location); err == nil && len(u.Scheme) > 1 {
+		if u.Scheme != "file" {
+			return "", false
+		}
+		location = u.Path
+		if runtime.GOOS == "windows" {
+			location = strings.TrimPrefix(location, "/")
+		}
+	}
+	// playlists written on Windows use backslashes
+	location = filepath.FromSlash(strings.ReplaceAll(location, `\`, "/"))
+	if !filepath.IsAbs(location) && filepath.VolumeName(location) == "" {
+		location = filepath.Join(dir, location)
+	}
+	return location, true
+}
+
+// parseM3U reads plain and extended M3U; the #EXTINF line before an entry gives its duration and title.
+func parseM3U(data []byte) []playlistEntry {
+	var entries []playlistEntry
+	info := playlistEntry{Duration: -1}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			duration, title, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			// attributes like tvg-id="..." may follow the duration
+			duration, _, _ = strings.Cut(duration, " ")
+			info.Title = strings.TrimSpace(title)
+			if d, err := strconv.ParseFloat(duration, 64); err == nil {
+				info.Duration = d
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			info.Path = line
+			entries = append(entries, info)
+			info = playlistEntry{Duration: -1}
+		}
+	}
+	return entries
+}
+
+// parsePLS reads the FileN, TitleN and LengthN keys of a PLS playlist, ordered by N.
+func parsePLS(data []byte) ([]playlistEntry, error) {
+	byNumber := map[int]*playlistEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if field == "" || err != nil {
+			continue
+		}
+		e := byNumber[n]
+		if e == nil {
+			e = &playlistEntry{Duration: -1}
+			byNumber[n] = e
+		}
+		value = strings.TrimSpace(value)
+		switch field {
+		case "file":
+			e.Path = value
+		case "title":
+			e.Title = value
+		case "length":
+			if d, err := strconv.ParseFloat(value, 64); err == nil {
+				e.Duration = d
+			}
+		}
+	}
+	numbers := make([]int, 0, len(byNumber))
+	for n, e := range byNumber {
+		if e.Path != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("no File entries")
+	}
+	sort.Ints(numbers)
+	entries := make([]playlistEntry, len(numbers))
+	for i, n := range numbers {
+		entries[i] = *byNumber[n]
+	}
+	return entries, nil
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Duration int    `xml:"duration,omitempty"` // milliseconds
+}
+
+func parseXSPF(data []byte) ([]playlistEntry, error) {
+	var pl struct {
+		Tracks []xspfTrack `xml:"trackList>track"`
+	}
+	if err := xml.Unmarshal(data, &pl); err != nil {
+		return nil, err
+	}
+	entries := make([]playlistEntry, 0, len(pl.Tracks))
+	for _, t := range pl.Tracks {
+		location := strings.TrimSpace(t.Location)
+		if location == "" {
+			continue
+		}
+		// locations are URIs, relative ones are percent-encoded too
+		if u, err := url.Parse(location); err == nil && u.Scheme == "" {
+			location = u.Path
+		}
+		e := playlistEntry{Path: location, Title: t.Title, Duration: -1}
+		if t.Duration > 0 {
+			e.Duration = float64(t.Duration) / 1000
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// writePlaylist writes entries as M3U8, PLS or XSPF depending on the extension of path. Entries
+// inside the directory of the playlist are written relative to it.
+func writePlaylist(path string, entries []playlistEntry) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	locations := make([]string, len(entries))
+	for i, e := range entries {
+		locations[i] = e.Path
+		if abs, err := filepath.Abs(e.Path); err == nil {
+			locations[i] = abs
+			if rel, err := filepath.Rel(dir, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				locations[i] = rel
+			}
+		}
+	}
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pls":
+		buf.WriteString("[playlist]\n")
+		for i, e := range entries {
+			fmt.Fprintf(&buf, "File%d=%s\n", i+1, locations[i])
+			fmt.Fprintf(&buf, "Title%d=%s\n", i+1, e.Title)
+			fmt.Fprintf(&buf, "Length%d=%.0f\n", i+1, e.Duration)
+		}
+		fmt.Fprintf(&buf, "NumberOfEntries=%d\nVersion=2\n", len(entries))
+	case ".xspf":
+		pl := xspfPlaylist{Version: "1"}
+		for i, e := range entries {
+			location := (&url.URL{Path: filepath.ToSlash(locations[i])}).String()
+			if filepath.IsAbs(locations[i]) {
+				location = (&url.URL{Scheme: "file", Path: "/" + strings.TrimPrefix(filepath.ToSlash(locations[i]), "/")}).String()
+			}
+			t := xspfTrack{Location: location, Title: e.Title}
+			if e.Duration > 0 {
+				t.Duration = int(e.Duration * 1000)
+			}
+			pl.Tracks = append(pl.Tracks, t)
+		}
+		buf.WriteString(xml.Header)
+		enc := xml.NewEncoder(&buf)
+		enc.Indent("", "  ")
+		if err := enc.Encode(pl); err != nil {
+			return err
+		}
+		buf.WriteString("\n")
+	default:
+		buf.WriteString("#EXTM3U\n")
+		for i, e := range entries {
+			fmt.Fprintf(&buf, "#EXTINF:%.0f,%s\n%s\n", e.Duration, e.Title, locations[i])
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// expandLoadArgs handles the playlist files, directories and patterns among the arguments of
+// load. The files they stand for are added to the queue, or with stack put in their place to be
+// loaded as tracks.
+func expandLoadArgs(args []string, stack, recursive bool) (files []string, enqueued int, err error) {
+	for _, arg := range args {
+		arg = expandHome(arg)
+		// existing paths come first, so names with brackets are not taken for patterns
+		info, statErr := os.Stat(arg)
+		switch {
+		case statErr == nil && info.IsDir():
+		case statErr == nil && isPlaylistFile(arg):
+		case statErr != nil && isPattern(arg):
+		default:
+			// a file, or a missing one that load reports
+			files = append(files, arg)
+			continue
+		}
+		if !stack {
+			n, err := queue.add([]string{arg}, recursive)
+			enqueued += n
+			if err != nil {
+				return nil, enqueued, err
+			}
+			continue
+		}
+		if !isPlaylistFile(arg) {
+			expanded, err := expandPath(arg, recursive)
+			if err != nil {
+				return nil, enqueued, err
+			}
+			files = append(files, expanded...)
+			continue
+		}
+		entries, err := readPlaylist(arg)
+		if err != nil {
+			return nil, enqueued, err
+		}
+		for _, e := range entries {
+			files = append(files, e.Path)
+		}
+	}
+	return files, enqueued, nil
+}
+
+// queueEntries returns the queue in play order for writing a playlist.
+func queueEntries() []playlistEntry {
+	entries := make([]playlistEntry, 0, len(queue.order))
+	for _, index := range queue.order {
+		file := queue.entries[index]
+		title := queue.titles[file]
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		entries = append(entries, playlistEntry{Path: file, Title: title, Duration: -1})
+	}
+	return entries
+}
+
+var playlistCmd = &cobra.Command{
+	Use:   "playlist",
+	Short: "Save the queue as a playlist file",
+}
+
+var playlistSaveCmd = &cobra.Command{
+	Use:               "save [file]",
+	Short:             "Write the queue to an M3U/M3U8, PLS or XSPF playlist, depending on the extension",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFiles,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(queue.entries) == 0 {
+			fmt.Println("The queue is empty")
+			return
+		}
+		if !isPlaylistFile(args[0]) {
+			fmt.Println("Playlist file must end in .m3u, .m3u8, .pls or .xspf")
+			return
+		}
+		if err := writePlaylist(args[0], queueEntries()); err != nil {
+			fmt.Printf("Failed to save playlist: %s\n", err)
+			return
+		}
+		fmt.Printf("Saved %d entries to %s\n", len(queue.entries), args[0])
+	},
+}
+
+func init() {
+	playlistCmd.AddCommand(playlistSaveCmd)
+	RootCmd.AddCommand(playlistCmd)
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseM3U(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []playlistEntry
+	}{
+		{
+			name: "plain",
+			data: "a.mp3\r\n\r\nsub/b.flac\n",
+			want: []playlistEntry{{Path: "a.mp3", Duration: -1}, {Path: "sub/b.flac", Duration: -1}},
+		},
+		{
+			name: "extended",
+			data: "#EXTM3U\n#EXTINF:215,Band - Song\nsong.mp3\n# a comment\n#EXTINF:-1 tvg-id=\"x\",Stream\nlive.ogg\nuntitled.wav\n",
+			want: []playlistEntry{
+				{Path: "song.mp3", Title: "Band - Song", Duration: 215},
+				{Path: "live.ogg", Title: "Stream", Duration: -1},
+				{Path: "untitled.wav", Duration: -1},
+			},
+		},
+		{
+			name: "empty",
+			data: "#EXTM3U\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := parseM3U([]byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseM3U = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParsePLS(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []playlistEntry // nil for an error
+	}{
+		{
+			name: "ordered by number",
+			data: "[playlist]\nFile2=b.mp3\nTitle2=Second\nFile10=c.mp3\nfile1 = a.mp3\nLength1=61\nLength2=-1\nNumberOfEntries=3\nVersion=2\n",
+			want: []playlistEntry{
+				{Path: "a.mp3", Duration: 61},
+				{Path: "b.mp3", Title: "Second", Duration: -1},
+				{Path: "c.mp3", Duration: -1},
+			},
+		},
+		{
+			name: "title without a file",
+			data: "[playlist]\nFile1=a.mp3\nTitle2=Orphan\n",
+			want: []playlistEntry{{Path: "a.mp3", Duration: -1}},
+		},
+		{
+			name: "no files",
+			data: "[playlist]\nNumberOfEntries=0\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := parsePLS([]byte(tt.data))
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: parsePLS = %+v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parsePLS = %+v, %v; want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseXSPF(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []playlistEntry // nil for an error
+	}{
+		{
+			name: "locations and metadata",
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track><location>file:///music/a.flac</location><title>A</title><duration>61500</duration></track>
+    <track><location>My%20Song.mp3</location></track>
+    <track><title>no location</title></track>
+  </trackList>
+</playlist>`,
+			want: []playlistEntry{
+				{Path: "file:///music/a.flac", Title: "A", Duration: 61.5},
+				{Path: "My Song.mp3", Duration: -1},
+			},
+		},
+		{
+			name: "not XML",
+			data: "#EXTM3U\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseXSPF([]byte(tt.data))
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: parseXSPF = %+v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseXSPF = %+v, %v; want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestWritePlaylistRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	entries := []playlistEntry{
+		{Path: filepath.Join(dir, "a.mp3"), Title: "Band - Song", Duration: 215},
+		{Path: filepath.Join(dir, "sub dir", "b #1.flac"), Duration: -1},
+		{Path: filepath.Join(outside, "c.wav"), Title: "Outside", Duration: 3},
+	}
+	for _, name := range []string{"list.m3u8", "list.pls", "list.xspf"} {
+		path := filepath.Join(dir, name)
+		if err := writePlaylist(path, entries); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		got, err := readPlaylist(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reflect.DeepEqual(got, entries) {
+			data, _ := os.ReadFile(path)
+			t.Errorf("%s: read back %+v, want %+v\n%s", name, got, entries, data)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/spf13/cobra"
+)
+
+// Repeat modes of the queue.
+const (
+	repeatOff = "off"
+	repeatOne = "one"
+	repeatAll = "all"
+)
+
+// playlist is a queue of files that are played one after another. Each entry becomes the
+// session of the audio panel in turn; the panel and its output registration stay the same.
+type playlist struct {
+	entries   []string
+	titles    map[string]string // titles of entries that came from playlist files
+	order     []int             // play order as indices into entries, shuffled or not
+	current   int               // index into entries of the playing entry, -1 if none
+	repeat    string
+	shuffle   bool
+	advancing bool // an entry ended and the next one is being loaded
+	crossfade time.Duration
+	next      *MultiTrackSeeker // the following entry, decoded ahead and lined up at the end of the loop
+	nextIndex int               // index into entries of next
+	ahead     int               // counts read-aheads so a stale one can tell it was superseded
+}
+
+var (
+	queue          = &playlist{current: -1, repeat: repeatOff}
+	queueCrossfade time.Duration
+	queueRecursive bool
+)
+
+// add appends files to the queue, expanding directories and patterns to the supported files
+// they contain and playlist files to their entries. Files are read without holding the output
+// lock; the entries are appended under it, as the audio thread steps through the queue.
+func (p *playlist) add(paths []string, recursive bool) (int, error) {
+	added := 0
+	for _, path := range paths {
+		var entries []playlistEntry
+		if isPlaylistFile(path) {
+			var err error
+			if entries, err = readPlaylist(path); err != nil {
+				return added, err
+			}
+		} else {
+			files, err := expandPath(path, recursive)
+			if err != nil {
+				return added, err
+			}
+			for _, file := range files {
+				entries = append(entries, playlistEntry{Path: file})
+			}
+		}
+		output.Lock()
+		for _, e := range entries {
+			p.append(e.Path)
+			if e.Title != "" {
+				if p.titles == nil {
+					p.titles = map[string]string{}
+				}
+				p.titles[e.Path] = e.Title
+			}
+		}
+		output.Unlock()
+		added += len(entries)
+	}
+	return added, nil
+}
+
+// append adds a file to the end of the queue. It must be called with the output locked.
+func (p *playlist) append(file string) {
+	p.entries = append(p.entries, file)
+	p.order = append(p.order, len(p.entries)-1)
+}
+
+// step returns the entry step places away from the current one in play order, wrapping around
+// with repeat all. ok is false when the queue runs out.
+func (p *playlist) step(step int) (index int, ok bool) {
+	if len(p.order) == 0 {
+		return -1, false
+	}
+	at := slices.Index(p.order, p.current)
+	if at < 0 {
+		if step < 0 {
+			return -1, false
+		}
+		return p.order[0], true
+	}
+	at += step
+	if at < 0 || at >= len(p.order) {
+		if p.repeat != repeatAll {
+			return -1, false
+		}
+		at = (at%len(p.order) + len(p.order)) % len(p.order)
+	}
+	return p.order[at], true
+}
+
+// setShuffle shuffles the play order, keeping the current entry first, or restores file order.
+func (p *playlist) setShuffle(on bool) {
+	p.shuffle = on
+	p.order = p.order[:0]
+	for i := range p.entries {
+		p.order = append(p.order, i)
+	}
+	if !on {
+		return
+	}
+	rand.Shuffle(len(p.order), func(i, j int) { p.order[i], p.order[j] = p.order[j], p.order[i] })
+	if at := slices.Index(p.order, p.current); at > 0 {
+		p.order[0], p.order[at] = p.order[at], p.order[0]
+	}
+}
+
+// play decodes an entry and makes it the session of the audio panel. Unlike load it replaces
+// the current session instead of adding tracks to it.
+func (p *playlist) play(index int) error {
+	mts, _, err := addFileTrack(nil, p.entries[index], 0)
+	if err != nil {
+		return err
+	}
+	var replaced *MultiTrackSeeker
+	if ap == nil {
+		ensureAudioPanel(mts)
+	} else {
+		output.Lock()
+		replaced = ap.swapSession(mts)
+		// a skip cuts the entry off; the stretcher must not play on from it
+		ap.stretcher.Reset()
+		output.Unlock()
+	}
+	output.Lock()
+	p.current = index
+	p.advancing = false
+	output.Unlock()
+	p.started(index, replaced)
+	return nil
+}
+
+// started finishes the switch to an entry outside of the audio thread: the session it replaced
+// is closed, markers are reset and restored from the sidecar, and the entry after it is decoded
+// ahead.
+func (p *playlist) started(index int, replaced *MultiTrackSeeker) {
+	if replaced != nil {
+		replaced.Close()
+	}
+	output.Lock()
+	if ap == nil {
+		output.Unlock()
+		return
+	}
+	if mts, ok := ap.streamer.(*MultiTrackSeeker); ok {
+		resetMarkers(mts)
+	}
+	output.Unlock()
+	loadMarkerSidecar()
+	fmt.Printf("Loaded [%d/%d] %s\n", slices.Index(p.order, index)+1, len(p.entries), p.entries[index])
+	p.readAhead()
+}
+
+// readAhead decodes the entry that follows the current one in the background and lines it up
+// at the end of the loop, so it follows without a gap or crossfades in. It is resampled to the
+// rate of the playing session, so taking over does not retune the output chain. Call it again
+// whenever the play order or the crossfade changes.
+func (p *playlist) readAhead() {
+	output.Lock()
+	p.ahead++
+	ahead := p.ahead
+	if p.next != nil {
+		p.next.Close()
+		p.next = nil
+	}
+	if ap != nil {
+		ap.loop.next = nil
+		ap.loop.nextHead = nil
+	}
+	index, ok := p.step(1)
+	if ap == nil || p.current < 0 || p.repeat == repeatOne {
+		ok = false
+	}
+	var file string
+	var sessionFormat beep.Format
+	var headLen int
+	if ok {
+		file = p.entries[index]
+		sessionFormat = format
+		headLen = ap.sampleRate.N(p.crossfade)
+	}
+	output.Unlock()
+	if !ok {
+		return
+	}
+	go func() {
+		mts, head, err := decodeAhead(file, sessionFormat, headLen)
+		if err != nil {
+			// skipped with a message once playback gets there
+			return
+		}
+		output.Lock()
+		defer output.Unlock()
+		if p.ahead != ahead || ap == nil {
+			mts.Close()
+			return
+		}
+		p.next, p.nextIndex = mts, index
+		ap.loop.next = mts
+		ap.loop.nextHead = head
+		ap.loop.head = nil
+	}()
+}
+
+// decodeAhead decodes file into a session of the given format and reads up to headLen samples
+// of its start for the crossfade.
+func decodeAhead(file string, f beep.Format, headLen int) (*MultiTrackSeeker, [][2]float64, error) {
+	streamer, decodedFormat, err := decodeFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	mts := NewMultiTrackSeeker([]beep.StreamSeeker{}, f)
+	mts.AddTrackWithOffset(streamer, decodedFormat, file, 0)
+	head := make([][2]float64, min(headLen, mts.Len()/2))
+	read := 0
+	for read < len(head) {
+		n, ok := mts.Stream(head[read:])
+		read += n
+		if !ok {
+			break
+		}
+	}
+	if err := mts.Seek(0); err != nil {
+		mts.Close()
+		return nil, nil, err
+	}
+	return mts, head[:read], nil
+}
+
+// skip plays the entry step places away, passing over entries that fail to load.
+func (p *playlist) skip(step int) error {
+	for range p.entries {
+		output.Lock()
+		index, ok := p.step(step)
+		output.Unlock()
+		if !ok {
+			return fmt.Errorf("no more entries in the queue")
+		}
+		err := p.play(index)
+		if err == nil {
+			return nil
+		}
+		fmt.Printf("Skipping %s: %s\n", p.entries[index], err)
+		output.Lock()
+		p.current = index
+		output.Unlock()
+		step = max(min(step, 1), -1)
+	}
+	return fmt.Errorf("no entry of the queue could be played")
+}
+
+// ended is called by the loop of the audio panel, while the output is streaming, when the
+// session has played to its end. It returns true to hold playback in silence while the next
+// entry is loaded, or false to let the session loop as usual. Loading and switching markers
+// happen in goroutines that hold commandMu, as commands change markers without the output lock.
+func (p *playlist) ended() bool {
+	if p.current < 0 || p.repeat == repeatOne {
+		return false
+	}
+	if p.advancing {
+		return true
+	}
+	if p.next != nil {
+		// decoded ahead: take over right here, in the same buffer, so nothing is lost in between;
+		// the panel adopts the session and its markers once the goroutine gets to it
+		mts, index := p.next, p.nextIndex
+		ap.spliceSession(mts)
+		p.next = nil
+		p.current = index
+		go func() {
+			commandMu.Lock()
+			defer commandMu.Unlock()
+			output.Lock()
+			if ap == nil || ap.loop.s != mts {
+				// closed or skipped in the meantime
+				output.Unlock()
+				mts.Close()
+				return
+			}
+			replaced := ap.adoptSession(mts)
+			output.Unlock()
+			p.started(index, replaced)
+		}()
+		return false
+	}
+	if _, ok := p.step(1); !ok {
+		// end of the queue: stop at the start of the last entry, outside of the audio thread
+		ap.ctrl.Paused = true
+		p.advancing = true
+		go func() {
+			output.Lock()
+			p.advancing = false
+			if ap != nil {
+				ap.seek(0)
+			}
+			output.Unlock()
+			fmt.Println("End of queue")
+		}()
+		return true
+	}
+	p.advancing = true
+	go func() {
+		commandMu.Lock()
+		defer commandMu.Unlock()
+		if err := p.skip(1); err != nil {
+			fmt.Println(err)
+			output.Lock()
+			p.advancing = false
+			output.Unlock()
+		}
+	}()
+	return true
+}
+
+// swapSession replaces the session of the audio panel in place, keeping the output chain. Loop,
+// tempo and speed trainer belong to the old session and are reset; markers are reset by started.
+// It must be called with the output locked. The replaced session is returned for the caller to
+// close.
+func (ap *audioPanel) swapSession(mts *MultiTrackSeeker) (replaced *MultiTrackSeeker) {
+	ap.spliceSession(mts)
+	return ap.adoptSession(mts)
+}
+
+// spliceSession makes the loop play mts and nothing else. It is all the audio thread does when
+// an entry decoded ahead takes over; adoptSession follows outside of it.
+func (ap *audioPanel) spliceSession(mts *MultiTrackSeeker) {
+	ap.loop.s = mts
+	ap.loop.next = nil
+	ap.loop.nextHead = nil
+	ap.loop.head = nil
+	ap.loop.onWrap = nil
+	ap.loop.unloop()
+	mts.SetSpeed(ap.speed)
+	ap.ctrl.Paused = false
+}
+
+// adoptSession makes the spliced mts the session the commands work on and returns the one it
+// replaced. The chain is only retuned when the sample rate changes, which never happens for an
+// entry decoded ahead. It must be called with the output locked.
+func (ap *audioPanel) adoptSession(mts *MultiTrackSeeker) (replaced *MultiTrackSeeker) {
+	stopTrainer()
+	tempo = nil
+	replaced, _ = ap.streamer.(*MultiTrackSeeker)
+	ap.streamer = mts
+	if rate := mts.format.SampleRate; rate != ap.sampleRate {
+		format = mts.format
+		ap.sampleRate = rate
+		ap.baseRatio = float64(rate) / float64(defaultSampleRate)
+		ap.updateResampleRatio()
+	}
+	ap.ctrl.Paused = false
+	return replaced
+}
+
+// setCrossfade applies --crossfade if it was given. Entries follow each other without a gap
+// while it is 0.
+func (p *playlist) setCrossfade(cmd *cobra.Command) {
+	if !cmd.Flags().Changed("crossfade") {
+		return
+	}
+	output.Lock()
+	p.crossfade = max(queueCrossfade, 0)
+	output.Unlock()
+	if p.crossfade > 0 {
+		fmt.Printf("Entries crossfade over %v\n", p.crossfade)
+	} else {
+		fmt.Println("Entries follow each other without a gap")
+	}
+	p.readAhead()
+}
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Manage the playlist queue: queue add <files/dirs>, queue list, queue clear",
+	Long: `Manage the playlist queue. When an entry ends, the next one follows without a gap: it is
+decoded while the current one plays and spliced in sample-accurately. --crossfade 5s blends the
+end of each entry into the start of the next with equal-power curves instead; --crossfade 0 goes
+back to gapless playback. The flag works on its own or with queue add.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("crossfade") {
+			cmd.Help()
+			return
+		}
+		queue.setCrossfade(cmd)
+	},
+}
+
+var queueAddCmd = &cobra.Command{
+	Use:               "add [file, directory, pattern or playlist...]",
+	Short:             "Add files, playlists, patterns like \"**/*.flac\" or the files of directories to the end of the queue",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeFiles,
+	Run: func(cmd *cobra.Command, args []string) {
+		added, err := queue.add(args, queueRecursive)
+		if err != nil {
+			fmt.Printf("Failed to add to the queue: %s\n", err)
+		}
+		if added == 0 {
+			return
+		}
+		fmt.Printf("Added %d entries to the queue (%d in total)\n", added, len(queue.entries))
+		if queue.shuffle {
+			output.Lock()
+			queue.setShuffle(true)
+			output.Unlock()
+		}
+		queue.setCrossfade(cmd)
+		// load the first entry right away when nothing is loaded yet
+		if ap == nil {
+			if err := queue.skip(1); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+		queue.readAhead()
+	},
+}
+
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the queue in play order",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(queue.entries) == 0 {
+			fmt.Println("The queue is empty")
+			return
+		}
+		// the audio thread moves on to the next entry under the lock
+		output.Lock()
+		current := queue.current
+		output.Unlock()
+		for i, index := range queue.order {
+			mark := " "
+			if index == current {
+				mark = ">"
+			}
+			fmt.Printf("%s %2d  %s\n", mark, i+1, queue.entries[index])
+		}
+		fade := "gapless"
+		if queue.crossfade > 0 {
+			fade = fmt.Sprintf("crossfade %v", queue.crossfade)
+		}
+		fmt.Printf("repeat: %s, shuffle: %t, %s\n", queue.repeat, queue.shuffle, fade)
+	},
+}
+
+var queueClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all entries from the queue; the current session keeps playing",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output.Lock()
+		queue.entries = nil
+		queue.titles = nil
+		queue.order = nil
+		queue.current = -1
+		output.Unlock()
+		queue.readAhead()
+		fmt.Println("Queue cleared")
+	},
+}
+
+var nextCmd = &cobra.Command{
+	Use:   "next",
+	Short: "Play the next entry of the queue",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := queue.skip(1); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var prevCmd = &cobra.Command{
+	Use:   "prev",
+	Short: "Play the previous entry of the queue",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := queue.skip(-1); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var repeatCmd = &cobra.Command{
+	Use:   "repeat [one|all|off]",
+	Short: "Repeat the current entry, the whole queue, or nothing",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mode := strings.ToLower(args[0])
+		switch mode {
+		case repeatOne, repeatAll, repeatOff:
+		default:
+			fmt.Printf("Unknown repeat mode %q (use one, all or off)\n", args[0])
+			return
+		}
+		output.Lock()
+		queue.repeat = mode
+		output.Unlock()
+		queue.readAhead()
+		fmt.Printf("Repeat %s\n", mode)
+	},
+}
+
+var shuffleCmd = &cobra.Command{
+	Use:   "shuffle [on|off]",
+	Short: "Toggle, or turn on or off, shuffled play order of the queue",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		on, err := parseOnOff(args, queue.shuffle)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		output.Lock()
+		queue.setShuffle(on)
+		output.Unlock()
+		queue.readAhead()
+		if on {
+			fmt.Println("Shuffle on")
+		} else {
+			fmt.Println("Shuffle off")
+		}
+	},
+}
+
+func init() {
+	queueCmd.Flags().DurationVar(&queueCrossfade, "crossfade", 0, "crossfade between entries, e.g. 5s; 0 plays them gapless")
+	queueAddCmd.Flags().BoolVarP(&queueRecursive, "recursive", "r", false, "add the files of subdirectories too")
+	queueAddCmd.Flags().DurationVar(&queueCrossfade, "crossfade", 0, "crossfade between entries, e.g. 5s; 0 plays them gapless")
+	queueCmd.AddCommand(queueAddCmd, queueListCmd, queueClearCmd)
+	RootCmd.AddCommand(queueCmd, nextCmd, prevCmd, repeatCmd, shuffleCmd)
+}
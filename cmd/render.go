@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/spf13/cobra"
+)
+
+// renderFormat is the format of the output chain: the speaker rate in 16-bit stereo.
+var renderFormat = beep.Format{SampleRate: defaultSampleRate, NumChannels: 2, Precision: 2}
+
+var renderWAV wavOptions
+
+// renderChain builds the processing that follows the loop and pause control in the audio panel
+// (time stretch, speed resampling and master volume) on top of src, for offline rendering.
+func (ap *audioPanel) renderChain(src beep.Streamer) beep.Streamer {
+	stretcher := NewTimeStretcher(ap.sampleRate, src)
+	resampler := beep.ResampleRatio(4, 1, stretcher)
+	ap.applySpeed(stretcher, resampler)
+	return &effects.Volume{
+		Streamer: resampler,
+		Base:     ap.volume.Base,
+		Volume:   ap.volume.Volume,
+		Silent:   ap.volume.Silent,
+	}
+}
+
+// renderProgress reports how much of its source has been streamed.
+type renderProgress struct {
+	s        beep.Streamer
+	total    int
+	done     int
+	reported int
+}
+
+func (p *renderProgress) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = p.s.Stream(samples)
+	p.done += n
+	if percent := p.done * 100 / max(p.total, 1); percent >= p.reported+5 || !ok {
+		p.reported = percent
+		fmt.Printf("\rRendering... %3d%%", percent)
+	}
+	return n, ok
+}
+
+func (p *renderProgress) Err() error {
+	return p.s.Err()
+}
+
+// readMix reads the mix of s between the start and end samples into memory and puts the
+// playhead back. Samples are kept as float32, unclipped, so the master volume still applies to
+// the full range of the mix.
+func readMix(s beep.StreamSeeker, start, end int) (beep.Streamer, error) {
+	resumePos := s.Position()
+	defer s.Seek(resumePos)
+	if err := s.Seek(start); err != nil {
+		return nil, err
+	}
+	mix := make([][2]float32, 0, end-start)
+	buf := make([][2]float64, 512)
+	take := beep.Take(end-start, s)
+	for {
+		n, ok := take.Stream(buf)
+		for _, x := range buf[:n] {
+			mix = append(mix, [2]float32{float32(x[0]), float32(x[1])})
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		if len(mix) == 0 {
+			return 0, false
+		}
+		n = min(len(samples), len(mix))
+		for i, x := range mix[:n] {
+			samples[i] = [2]float64{float64(x[0]), float64(x[1])}
+		}
+		mix = mix[n:]
+		return n, true
+	}), nil
+}
+
+// renderRange renders the session between the start and end samples through the output chain,
+// without looping, into a WAV file.
+func renderRange(file string, start, end int, opts wavOptions) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Playback and rendering share the streamer, so the mix is read while holding the output,
+	// like save does, along with the chain settings. Time stretching, resampling and encoding
+	// run after it is released, so playback goes on meanwhile.
+	output.Lock()
+	mix, err := readMix(ap.streamer, start, end)
+	if err != nil {
+		output.Unlock()
+		return err
+	}
+	chain := ap.renderChain(&renderProgress{s: mix, total: end - start})
+	// one rendered sample covers ratio session samples before conversion to the output rate
+	scale := float64(opts.SampleRate) / float64(renderFormat.SampleRate) / ap.playbackRatio()
+	chunks := wavMarkerChunks(start, end, scale, opts.SampleRate)
+	output.Unlock()
+	err = encodeWAV(f, chain, renderFormat.SampleRate, opts, chunks...)
+	fmt.Println()
+	return err
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render [output_file] [start_marker] [end_marker]",
+	Short: "Render the mix with volume and speed applied to a WAV file, faster than real time",
+	Long: `Render the complete output chain (speed, master volume and all track settings, without
+looping) to a .wav file. Without markers the whole session is rendered; a single region marker or
+a start and an end marker render only that part.`,
+	Args:              cobra.RangeArgs(1, 3),
+	ValidArgsFunction: completeFiles,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireAudioLoaded() {
+			return
+		}
+		opts, err := renderWAV.resolve(renderFormat)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		outputFile := args[0]
+		start, end, desc := 0, ap.streamer.Len(), "the whole session"
+		if len(args) > 1 {
+			start, end, desc, err = markerRange(args[1:])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		if err := renderRange(outputFile, start, end, opts); err != nil {
+			fmt.Printf("Failed to render: %s\n", err)
+			return
+		}
+		fmt.Printf("Rendered %s to %s (%s)\n", desc, outputFile, opts.describe())
+	},
+}
+
+func init() {
+	addWAVFlags(renderCmd.Flags(), &renderWAV)
+	RootCmd.AddCommand(renderCmd)
+}
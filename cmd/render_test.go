@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep/v2/wav"
+)
+
+func TestRenderRange(t *testing.T) {
+	newTestSession(t, 4)
+	if err := ap.seek(500); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "render.wav")
+	opts, err := wavOptions{BitDepth: 16}.resolve(renderFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := renderRange(path, 1000, 3000, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := ap.streamer.Position(); got != 500 {
+		t.Errorf("playhead at %d after rendering, want 500", got)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, rendered, err := wav.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two seconds of the session at the output rate
+	want := rendered.SampleRate.N(2 * time.Second)
+	if got := s.Len(); got < want-want/100 || got > want {
+		t.Errorf("rendered %d samples, want about %d", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const trackResampleQuality = 4
+
+// ResampleSeeker converts a StreamSeeker to another sample rate while keeping it seekable.
+//
+// beep.Resampler is a plain Streamer and buffers ahead of its source, so seeking recreates the
+// resampler at the source position that corresponds to the requested output position.
+type ResampleSeeker struct {
+	source    beep.StreamSeeker
+	from      beep.SampleRate
+	to        beep.SampleRate
+	resampler *beep.Resampler
+	pos       int
+}
+
+func NewResampleSeeker(s beep.StreamSeeker, from, to beep.SampleRate) *ResampleSeeker {
+	return &ResampleSeeker{
+		source:    s,
+		from:      from,
+		to:        to,
+		resampler: beep.Resample(trackResampleQuality, from, to, s),
+	}
+}
+
+func (r *ResampleSeeker) Stream(samples [][2]float64) (n int, ok bool) {
+	if remaining := r.Len() - r.pos; remaining < len(samples) {
+		if remaining <= 0 {
+			return 0, false
+		}
+		samples = samples[:remaining]
+	}
+	n, ok = r.resampler.Stream(samples)
+	r.pos += n
+	return n, ok
+}
+
+func (r *ResampleSeeker) Err() error {
+	return r.source.Err()
+}
+
+func (r *ResampleSeeker) Len() int {
+	return int(int64(r.source.Len()) * int64(r.to) / int64(r.from))
+}
+
+func (r *ResampleSeeker) Position() int {
+	return r.pos
+}
+
+func (r *ResampleSeeker) Seek(p int) error {
+	if p < 0 || p > r.Len() {
+		return fmt.Errorf("seek position out of range")
+	}
+	sourcePos := int(int64(p) * int64(r.from) / int64(r.to))
+	if sourcePos > r.source.Len() {
+		sourcePos = r.source.Len()
+	}
+	if err := r.source.Seek(sourcePos); err != nil {
+		return err
+	}
+	r.resampler = beep.Resample(trackResampleQuality, r.from, r.to, r.source)
+	r.pos = p
+	return nil
+}
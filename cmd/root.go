@@ -3,32 +3,25 @@ package cmd
 import (
 	"fmt"
 	"github.com/gopxl/beep/v2"
-	"github.com/gopxl/beep/v2/speaker"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"os"
 	"sync"
-	"time"
 )
 
 const defaultSampleRate = beep.SampleRate(44100)
 
+var soundFontPath string
+
 var (
-	speakerOnce    sync.Once
-	speakerInitErr error
-	soundFontPath  string
+	// commandMu is held while a command runs. The goroutines the audio thread starts to finish
+	// its work, like switching markers and sidecar over to the next queue entry, take it too, so
+	// they never run in the middle of a command.
+	commandMu sync.Mutex
+	// interactiveCmds read and run other commands, which take commandMu themselves.
+	interactiveCmds = map[*cobra.Command]bool{}
 )
 
-func ensureSpeaker() error {
-	speakerOnce.Do(func() {
-		sr := defaultSampleRate
-		speakerInitErr = speaker.Init(sr, sr.N(time.Second/10))
-	})
-	if speakerInitErr != nil {
-		return fmt.Errorf("failed to init speaker: %w", speakerInitErr)
-	}
-	return nil
-}
-
 var RootCmd = &cobra.Command{
 	Use:   "app",
 	Short: "A music player application",
@@ -36,25 +29,61 @@ var RootCmd = &cobra.Command{
 You can use the 'play' command followed by the file path to play a music file.`,
 	Args: cobra.ArbitraryArgs,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return ensureSpeaker()
+		if err := ensureOutput(); err != nil {
+			return err
+		}
+		if !interactiveCmds[cmd] {
+			commandMu.Lock()
+		}
+		return nil
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		if ap != nil {
 			ap.play()
 		}
+		resetFlags(cmd)
+		if !interactiveCmds[cmd] {
+			commandMu.Unlock()
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		// --session is persistent; clear it so bare files given later in the shell do not open
+		// the session again
+		session := sessionPath
+		sessionPath = ""
+		if session != "" {
+			if err := openSession(session); err != nil {
+				fmt.Printf("Failed to open session: %s\n", err)
+			}
+		}
 		if len(args) >= 1 {
 			loadCmd.Run(cmd, args)
-		} else {
+		} else if session == "" {
 			cmd.Help()
 		}
 	},
 }
 
+// resetFlags restores a command's local flags to their defaults. Commands are executed
+// repeatedly from keyboard mode, and cobra would otherwise keep the previous values.
+func resetFlags(cmd *cobra.Command) {
+	cmd.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			sv.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
+
 func init() {
 	RootCmd.PersistentFlags().StringVar(&soundFontPath, "soundfont", "", "path to SoundFont (.sf2) for MIDI playback")
+	RootCmd.PersistentFlags().StringVar(&outputName, "output", "speaker", "audio output: speaker, or null to run without a sound card")
+	RootCmd.PersistentFlags().StringVar(&outputClock, "output-clock", "realtime", "clock of the null output: realtime, or fast to pull audio as fast as possible")
 	RootCmd.AddCommand(exitCmd)
+	interactiveCmds[shellCmd] = true
+	interactiveCmds[keyboardCmd] = true
 }
 
 func Execute() {
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const sessionVersion = 1
+
+// sessionFile is the on-disk JSON representation of a multitrack session.
+type sessionFile struct {
+	Version   int                `json:"version"`
+	SoundFont string             `json:"soundfont,omitempty"`
+	Tracks    []sessionTrack     `json:"tracks"`
+	Markers   []PlaybackPosition `json:"markers"`
+	Loop      sessionLoop        `json:"loop"`
+	Volume    *float64           `json:"volume,omitempty"` // percent, nil in files without it
+	Speed     float64            `json:"speed"`
+	SpeedMode string             `json:"speed_mode,omitempty"`
+	Pitch     float64            `json:"pitch,omitempty"` // semitones
+	Tempo     *sessionTempo      `json:"tempo,omitempty"`
+	Position  int                `json:"position"` // playhead in samples
+}
+
+type sessionTrack struct {
+	Path      string  `json:"path"`
+	Offset    float64 `json:"offset"`
+	Gain      float64 `json:"gain,omitempty"`
+	Pan       float64 `json:"pan,omitempty"`
+	Mute      bool    `json:"mute,omitempty"`
+	Solo      bool    `json:"solo,omitempty"`
+	FadeIn    float64 `json:"fade_in,omitempty"`  // seconds
+	FadeOut   float64 `json:"fade_out,omitempty"` // seconds
+	FadeCurve string  `json:"fade_curve,omitempty"`
+}
+
+// sessionTempo stores the tempo grid; the click track is generated again from it.
+type sessionTempo struct {
+	BPM        float64 `json:"bpm"`
+	Beats      int     `json:"beats"`
+	Unit       int     `json:"unit"`
+	Offset     int     `json:"offset"` // samples
+	ClickMuted bool    `json:"click_muted"`
+}
+
+type sessionLoop struct {
+	Start     int `json:"start"`
+	End       int `json:"end"`
+	Crossfade int `json:"crossfade,omitempty"` // samples
+}
+
+var sessionPath string
+
+// sessionRelPath expresses path relative to the session directory when possible, so session
+// files can be committed next to the audio they reference.
+func sessionRelPath(dir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return abs
+}
+
+// sessionAbsPath resolves a path stored in a session file against the session directory.
+func sessionAbsPath(dir, path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func saveSession(file string) error {
+	if ap == nil {
+		return fmt.Errorf("no audio loaded")
+	}
+	mts, ok := ap.streamer.(*MultiTrackSeeker)
+	if !ok {
+		return fmt.Errorf("current streamer is not a MultiTrackSeeker")
+	}
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return err
+	}
+	output.Lock()
+	volume := ap.volumePercent()
+	sf := sessionFile{
+		Version:   sessionVersion,
+		Markers:   append([]PlaybackPosition(nil), Markers...),
+		Loop:      sessionLoop{Start: ap.loop.start, End: ap.loop.end, Crossfade: ap.loop.xfade},
+		Volume:    &volume,
+		Speed:     ap.speed,
+		SpeedMode: ap.speedMode,
+		Pitch:     mts.pitch,
+		Position:  ap.streamer.Position(),
+	}
+	if tempo != nil {
+		sf.Tempo = &sessionTempo{BPM: tempo.BPM, Beats: tempo.Beats, Unit: tempo.Unit, Offset: tempo.Offset, ClickMuted: true}
+	}
+	for _, t := range mts.Tracks {
+		if t.Generated {
+			if _, ok := t.Streamer.(*clickTrack); ok && sf.Tempo != nil {
+				sf.Tempo.ClickMuted = t.Mute
+			}
+			continue
+		}
+		st := sessionTrack{
+			Path:   sessionRelPath(dir, t.TrackName),
+			Offset: t.Offset,
+			Gain:   t.Gain,
+			Pan:    t.Pan,
+			Mute:   t.Mute,
+			Solo:   t.Solo,
+		}
+		if t.Fader != nil {
+			st.FadeIn = t.Fader.FadeIn.Seconds()
+			st.FadeOut = t.Fader.FadeOut.Seconds()
+			st.FadeCurve = t.Fader.Curve.String()
+		}
+		sf.Tracks = append(sf.Tracks, st)
+	}
+	output.Unlock()
+	if soundFontPath != "" {
+		sf.SoundFont = sessionRelPath(dir, soundFontPath)
+	}
+	data, err := json.MarshalIndent(sf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+func openSession(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var sf sessionFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return fmt.Errorf("failed to parse session %s: %w", file, err)
+	}
+	if sf.Version > sessionVersion {
+		return fmt.Errorf("session %s has unsupported version %d", file, sf.Version)
+	}
+	if len(sf.Tracks) == 0 {
+		return fmt.Errorf("session %s has no tracks", file)
+	}
+	dir := filepath.Dir(file)
+	if sf.SoundFont != "" {
+		sfPath := sessionAbsPath(dir, sf.SoundFont)
+		if soundFontPath == "" {
+			soundFontPath = sfPath
+		} else if soundFontPath != sfPath {
+			fmt.Printf("Keeping soundfont %s (session uses %s)\n", soundFontPath, sfPath)
+		}
+	}
+
+	// Decode into a fresh MultiTrackSeeker first so a broken session leaves the current one alone.
+	var mts *MultiTrackSeeker
+	discard := func(err error) error {
+		if mts != nil {
+			mts.Close()
+		}
+		return err
+	}
+	for _, st := range sf.Tracks {
+		curve, err := parseFadeCurve(st.FadeCurve)
+		if err != nil {
+			return discard(err)
+		}
+		path := sessionAbsPath(dir, st.Path)
+		next, t, err := addFileTrack(mts, path, st.Offset)
+		if err != nil {
+			return discard(err)
+		}
+		mts = next
+		t.Gain = st.Gain
+		t.Pan = st.Pan
+		t.Mute = st.Mute
+		t.Solo = st.Solo
+		t.Fader.FadeIn = time.Duration(st.FadeIn * float64(time.Second))
+		t.Fader.FadeOut = time.Duration(st.FadeOut * float64(time.Second))
+		t.Fader.Curve = curve
+	}
+	if sf.Pitch != 0 && mts != nil {
+		if err := setPitch(mts, sf.Pitch); err != nil {
+			return discard(err)
+		}
+	}
+
+	closeSession()
+	ensureAudioPanel(mts)
+	if len(sf.Markers) > 0 {
+		Markers = sf.Markers
+	}
+	output.Lock()
+	defer output.Unlock()
+	if sf.Loop.End > sf.Loop.Start && sf.Loop.End <= mts.Len() {
+		ap.loop.start = sf.Loop.Start
+		ap.loop.end = sf.Loop.End
+	}
+	ap.loop.xfade = max(sf.Loop.Crossfade, 0)
+	if st := sf.Tempo; st != nil && st.BPM > 0 && st.Beats > 0 && st.Unit > 0 {
+		click := setTempo(mts, &tempoGrid{BPM: st.BPM, Beats: st.Beats, Unit: st.Unit, Offset: st.Offset})
+		click.Mute = st.ClickMuted
+	}
+	if sf.Volume != nil {
+		ap.setVolumePercent(*sf.Volume)
+	}
+	if mode, err := parseSpeedMode(sf.SpeedMode); err == nil {
+		ap.speedMode = mode
+	}
+	if sf.Speed > 0 {
+		ap.setSpeed(sf.Speed)
+	}
+	if sf.Position > 0 && sf.Position < mts.Len() {
+		if err := ap.seek(sf.Position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Save or open a multitrack session file",
+}
+
+var sessionSaveCmd = &cobra.Command{
+	Use:               "save [file]",
+	Short:             "Save tracks, markers, loop, volume, speed, pitch and playhead to a JSON session file",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFiles,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := saveSession(args[0]); err != nil {
+			fmt.Printf("Failed to save session: %s\n", err)
+			return
+		}
+		fmt.Printf("Session saved to %s\n", args[0])
+	},
+}
+
+var sessionOpenCmd = &cobra.Command{
+	Use:               "open [file]",
+	Short:             "Replace the current session with one saved by 'session save'",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFiles,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := openSession(args[0]); err != nil {
+			fmt.Printf("Failed to open session: %s\n", err)
+			return
+		}
+		fmt.Printf("Session %s opened\n", args[0])
+	},
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&sessionPath, "session", "", "open a session file at startup")
+	sessionCmd.AddCommand(sessionSaveCmd, sessionOpenCmd)
+	RootCmd.AddCommand(sessionCmd)
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+)
+
+const historyFileName = ".gordon_history"
+
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+// newLineReader creates a readline instance with persistent history, Ctrl-R search and
+// completion of commands, file paths and markers.
+func newLineReader() (*readline.Instance, error) {
+	return readline.NewEx(&readline.Config{
+		Prompt:            "> ",
+		HistoryFile:       historyFile(),
+		HistorySearchFold: true,
+		AutoComplete:      commandCompleter{},
+		InterruptPrompt:   "^C",
+		EOFPrompt:         "exit",
+	})
+}
+
+// splitCommands splits a line into the commands separated by ';', ignoring quoted semicolons.
+func splitCommands(line string) []string {
+	var commands []string
+	var quote rune
+	start := 0
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ';':
+			commands = append(commands, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(commands, line[start:])
+}
+
+// runLine executes every ';'-separated command of a line.
+func runLine(line string) {
+	for _, command := range splitCommands(line) {
+		args := splitArgs(command)
+		if len(args) == 0 {
+			continue
+		}
+		RootCmd.SetArgs(args)
+		if err := RootCmd.Execute(); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// Shell reads and executes commands until the user exits or closes the input.
+func Shell() {
+	rl, err := newLineReader()
+	if err != nil {
+		fmt.Printf("Failed to start shell: %s\n", err)
+		return
+	}
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		runLine(line)
+	}
+	rl.Close()
+	RootCmd.SetArgs([]string{"exit"})
+	RootCmd.Execute()
+}
+
+// commandCompleter completes command names from RootCmd, and arguments through each
+// command's ValidArgsFunction, falling back to file paths when the command allows it.
+type commandCompleter struct{}
+
+func (commandCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	commands := splitCommands(string(line[:pos]))
+	current := commands[len(commands)-1]
+	partial := ""
+	if i := strings.LastIndexAny(current, " \t"); i >= 0 {
+		partial = current[i+1:]
+		current = current[:i+1]
+	} else {
+		partial, current = current, ""
+	}
+	args := splitArgs(current)
+
+	var candidates []string
+	c, rest, err := RootCmd.Find(args)
+	switch {
+	case err != nil:
+		return nil, 0
+	case len(rest) == 0 && c.HasAvailableSubCommands():
+		candidates = commandNames(c)
+	case c.ValidArgsFunction != nil:
+		var directive cobra.ShellCompDirective
+		candidates, directive = c.ValidArgsFunction(c, rest, partial)
+		if len(candidates) == 0 && directive&cobra.ShellCompDirectiveNoFileComp == 0 {
+			candidates = completePath(partial)
+		}
+	}
+
+	var suffixes [][]rune
+	for _, candidate := range candidates {
+		if !strings.HasPrefix(candidate, partial) {
+			continue
+		}
+		// finish the word unless a directory was completed
+		if !strings.HasSuffix(candidate, string(filepath.Separator)) {
+			candidate += " "
+		}
+		suffixes = append(suffixes, []rune(candidate[len(partial):]))
+	}
+	return suffixes, len([]rune(partial))
+}
+
+// commandNames lists the available subcommands of c and their aliases.
+func commandNames(c *cobra.Command) []string {
+	var names []string
+	for _, sub := range c.Commands() {
+		if !sub.IsAvailableCommand() {
+			continue
+		}
+		names = append(names, sub.Name())
+		names = append(names, sub.Aliases...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completePath lists the files and directories that start with partial.
+func completePath(partial string) []string {
+	dir, base := filepath.Split(partial)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), base) || (strings.HasPrefix(e.Name(), ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			paths = append(paths, dir+e.Name()+string(filepath.Separator))
+		} else {
+			paths = append(paths, dir+e.Name())
+		}
+	}
+	return paths
+}
+
+// completeFiles is a ValidArgsFunction for commands that take file paths.
+func completeFiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveDefault
+}
+
+// completeMarkerArgs returns a ValidArgsFunction that completes marker indices and labels for
+// the first n arguments, followed by file paths if files is set.
+func completeMarkerArgs(n int, files bool) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= n {
+			if files {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var candidates []string
+		for i, m := range Markers {
+			if !m.Set {
+				continue
+			}
+			candidates = append(candidates, strconv.Itoa(i))
+			if m.Label != "" {
+				if strings.ContainsAny(m.Label, " \t") {
+					candidates = append(candidates, strconv.Quote(m.Label))
+				} else {
+					candidates = append(candidates, m.Label)
+				}
+			}
+		}
+		return candidates, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Interactive command shell with history, Ctrl-R search and tab completion",
+	Long: `Interactive command shell. History is kept in ~/.gordon_history, Ctrl-R searches it and Tab
+completes commands, file paths for load and markers for goto/loop. Several commands can be given on
+one line separated by ';'.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		Shell()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(shellCmd)
+}
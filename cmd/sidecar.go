@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const sidecarSuffix = ".gordon.json"
+
+// markerSidecar stores markers and loop regions next to the first loaded file, e.g.
+// song.mp3.gordon.json. It keeps one entry per loaded file set, so the markers of a multitrack
+// setup and those of the file loaded on its own do not overwrite each other.
+type markerSidecar struct {
+	Sets []sidecarSet `json:"sets"`
+}
+
+// sidecarSet holds the markers and loop region of one loaded file set.
+type sidecarSet struct {
+	Files   []string           `json:"files"`
+	Markers []PlaybackPosition `json:"markers"`
+	Loop    sessionLoop        `json:"loop"`
+}
+
+// readMarkerSidecar reads the sidecar at path. A missing sidecar has no entries.
+func readMarkerSidecar(path string) (markerSidecar, error) {
+	var sc markerSidecar
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sc, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &sc)
+	}
+	return sc, err
+}
+
+// find returns the entry of the file set, or nil if there is none.
+func (sc *markerSidecar) find(files []string) *sidecarSet {
+	for i := range sc.Sets {
+		if slices.Equal(sc.Sets[i].Files, files) {
+			return &sc.Sets[i]
+		}
+	}
+	return nil
+}
+
+// sidecarTarget returns the sidecar path and the file set it is keyed by.
+func sidecarTarget(mts *MultiTrackSeeker) (string, []string) {
+	var loaded []Track
+	for _, t := range mts.Tracks {
+		if !t.Generated {
+			loaded = append(loaded, t)
+		}
+	}
+	if len(loaded) == 0 {
+		return "", nil
+	}
+	path := loaded[0].TrackName + sidecarSuffix
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return "", nil
+	}
+	files := make([]string, 0, len(loaded))
+	for _, t := range loaded {
+		files = append(files, sessionRelPath(dir, t.TrackName))
+	}
+	return path, files
+}
+
+// saveMarkerSidecar writes the current markers and loop region to the entry of the loaded file
+// set in its sidecar, keeping the entries of other sets.
+func saveMarkerSidecar() {
+	if ap == nil {
+		return
+	}
+	mts, ok := ap.streamer.(*MultiTrackSeeker)
+	if !ok {
+		return
+	}
+	path, files := sidecarTarget(mts)
+	if path == "" {
+		return
+	}
+	output.Lock()
+	set := sidecarSet{
+		Files:   files,
+		Markers: append([]PlaybackPosition(nil), Markers...),
+		Loop:    sessionLoop{Start: ap.loop.start, End: ap.loop.end, Crossfade: ap.loop.xfade},
+	}
+	output.Unlock()
+	sc, err := readMarkerSidecar(path)
+	if err != nil {
+		// left alone rather than losing the entries of other sets
+		fmt.Printf("Failed to read marker sidecar %s: %s\n", path, err)
+		return
+	}
+	if old := sc.find(files); old != nil {
+		*old = set
+	} else {
+		sc.Sets = append(sc.Sets, set)
+	}
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Printf("Failed to write marker sidecar: %s\n", err)
+	}
+}
+
+// loadMarkerSidecar restores markers and the loop region saved for the loaded file set.
+func loadMarkerSidecar() {
+	if ap == nil {
+		return
+	}
+	mts, ok := ap.streamer.(*MultiTrackSeeker)
+	if !ok {
+		return
+	}
+	path, files := sidecarTarget(mts)
+	if path == "" {
+		return
+	}
+	sc, err := readMarkerSidecar(path)
+	if err != nil {
+		fmt.Printf("Failed to read marker sidecar %s: %s\n", path, err)
+		return
+	}
+	set := sc.find(files)
+	if set == nil {
+		return
+	}
+	output.Lock()
+	if len(set.Markers) > 0 {
+		Markers = set.Markers
+	}
+	if set.Loop.End > set.Loop.Start && set.Loop.End <= mts.Len() {
+		ap.loop.start = set.Loop.Start
+		ap.loop.end = set.Loop.End
+	}
+	ap.loop.xfade = max(set.Loop.Crossfade, 0)
+	output.Unlock()
+	fmt.Printf("Restored markers from %s\n", path)
+}
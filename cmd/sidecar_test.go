@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+func TestSidecarKeepsFileSets(t *testing.T) {
+	mts := newTestSession(t, 10)
+	Markers[3] = newMarker(3000, "alone")
+	saveMarkerSidecar()
+
+	buffer := beep.NewBuffer(format)
+	buffer.Append(beep.Silence(mts.Len()))
+	other := filepath.Join(filepath.Dir(mts.Tracks[0].TrackName), "other.wav")
+	mts.AddTrackWithOffset(buffer.Streamer(0, buffer.Len()), format, other, 0)
+	resetMarkers(mts)
+	Markers[4] = newMarker(4000, "together")
+	saveMarkerSidecar()
+
+	path, _ := sidecarTarget(mts)
+	sc, err := readMarkerSidecar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.Sets) != 2 {
+		t.Fatalf("%d entries in the sidecar, want one per file set", len(sc.Sets))
+	}
+
+	if err := mts.RemoveTrack(1); err != nil {
+		t.Fatal(err)
+	}
+	resetMarkers(mts)
+	loadMarkerSidecar()
+	if Markers[3].Label != "alone" || Markers[4].Set {
+		t.Errorf("markers of the single file: %+v", Markers[3:5])
+	}
+}
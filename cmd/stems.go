@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// stemFileName derives a file name for a track from its number and TrackName, e.g. "02-bass.wav".
+func stemFileName(t Track) string {
+	base := filepath.Base(t.TrackName)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, base)
+	return fmt.Sprintf("%02d-%s.wav", t.TrackNumber, safe)
+}
+
+// saveStems writes one WAV file per track for the range between start and end. Each stem keeps
+// the track's offset as leading silence, its gain, pan and fades, and has the full range length,
+// so all stems line up when imported side by side. Mute and solo are ignored.
+func saveStems(mts *MultiTrackSeeker, dir string, start, end int, opts wavOptions) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Read every stem into memory while holding the output, like save does for the mix.
+	buffers := make([]*beep.Buffer, len(mts.Tracks))
+	output.Lock()
+	resumePos := mts.Position()
+	mts.SetSpeed(1)
+	var err error
+	for i := range mts.Tracks {
+		t := &mts.Tracks[i]
+		if t.Generated {
+			continue
+		}
+		if err = t.Streamer.Seek(min(start, t.Streamer.Len())); err != nil {
+			break
+		}
+		buffers[i] = beep.NewBuffer(format)
+		buffers[i].Append(beep.Take(end-start, beep.Seq(t.withMix(t.Streamer), beep.Silence(-1))))
+	}
+	mts.SetSpeed(ap.speed)
+	mts.Seek(resumePos)
+	output.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := wavMarkerChunks(start, end, float64(opts.SampleRate)/float64(format.SampleRate), opts.SampleRate)
+	var files []string
+	for i, t := range mts.Tracks {
+		if t.Generated {
+			continue
+		}
+		file := filepath.Join(dir, stemFileName(t))
+		f, err := os.Create(file)
+		if err != nil {
+			return files, err
+		}
+		err = encodeWAV(f, buffers[i].Streamer(0, buffers[i].Len()), format.SampleRate, opts, chunks...)
+		f.Close()
+		if err != nil {
+			return files, fmt.Errorf("failed to encode %s: %w", file, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"math"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// TimeStretcher changes the tempo of its source without changing its pitch, using WSOLA
+// (waveform similarity overlap-add).
+//
+// Output is built from Hann-windowed frames that overlap by half. The frames are taken from
+// the source at a spacing of ratio times the output spacing, each one shifted by up to the
+// search tolerance so that it lines up with the waveform the previous frame would have
+// continued with. This keeps periodic signals in phase and avoids the pitch change of resampling.
+type TimeStretcher struct {
+	Streamer beep.Streamer
+
+	ratio  float64 // source samples consumed per output sample
+	bypass bool
+
+	frame, hop, tolerance int
+	window                []float64
+
+	in      [][2]float64 // buffered source, in[0] is source sample inStart
+	inStart int
+	eof     bool
+
+	nominal float64 // source position the next frame would take without searching
+	prevPos int     // source position of the previous frame, -1 before the first
+	acc     [][2]float64
+	wsum    []float64
+	ready   [][2]float64 // finished output not yet streamed
+	readyAt int
+	flushed bool
+}
+
+// NewTimeStretcher creates a TimeStretcher with frames of about 40 ms at the given sample rate.
+func NewTimeStretcher(sampleRate beep.SampleRate, s beep.Streamer) *TimeStretcher {
+	frame := sampleRate.N(40*time.Millisecond) &^ 1
+	t := &TimeStretcher{
+		Streamer:  s,
+		ratio:     1,
+		frame:     frame,
+		hop:       frame / 2,
+		tolerance: sampleRate.N(10 * time.Millisecond),
+		window:    make([]float64, frame),
+		acc:       make([][2]float64, frame),
+		wsum:      make([]float64, frame),
+	}
+	for i := range t.window {
+		t.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frame))
+	}
+	t.Reset()
+	return t
+}
+
+// SetRatio sets how many source samples make up one output sample, i.e. the playback speed.
+func (t *TimeStretcher) SetRatio(ratio float64) {
+	if ratio <= 0 {
+		ratio = 1
+	}
+	t.ratio = ratio
+}
+
+// Ratio returns the current ratio.
+func (t *TimeStretcher) Ratio() float64 {
+	return t.ratio
+}
+
+// SetBypass passes the source through untouched when bypass is true. Switching drops the few
+// milliseconds of audio buffered for stretching.
+func (t *TimeStretcher) SetBypass(bypass bool) {
+	if bypass != t.bypass {
+		t.Reset()
+	}
+	t.bypass = bypass
+}
+
+// Reset drops the buffered source and output. Call it when the source jumps to another
+// position, or the audio from before the jump plays on for a frame.
+func (t *TimeStretcher) Reset() {
+	t.in = t.in[:0]
+	t.inStart = 0
+	t.eof = false
+	t.nominal = 0
+	t.prevPos = -1
+	clear(t.acc)
+	clear(t.wsum)
+	t.ready = t.ready[:0]
+	t.readyAt = 0
+	t.flushed = false
+}
+
+func (t *TimeStretcher) Stream(samples [][2]float64) (n int, ok bool) {
+	if t.bypass {
+		return t.Streamer.Stream(samples)
+	}
+	for n < len(samples) {
+		if t.readyAt == len(t.ready) && !t.nextFrame() {
+			break
+		}
+		c := copy(samples[n:], t.ready[t.readyAt:])
+		t.readyAt += c
+		n += c
+	}
+	return n, n > 0
+}
+
+func (t *TimeStretcher) Err() error {
+	return t.Streamer.Err()
+}
+
+// at returns source sample i, or silence outside the buffered range.
+func (t *TimeStretcher) at(i int) [2]float64 {
+	if i < t.inStart || i >= t.inStart+len(t.in) {
+		return [2]float64{}
+	}
+	return t.in[i-t.inStart]
+}
+
+// fill buffers the source up to, but not including, sample end.
+func (t *TimeStretcher) fill(end int) {
+	for !t.eof && t.inStart+len(t.in) < end {
+		have := len(t.in)
+		want := end - t.inStart
+		if cap(t.in) < want {
+			grown := make([][2]float64, have, want+t.frame)
+			copy(grown, t.in)
+			t.in = grown
+		}
+		t.in = t.in[:want]
+		n, ok := t.Streamer.Stream(t.in[have:])
+		t.in = t.in[:have+n]
+		if !ok {
+			t.eof = true
+		}
+	}
+}
+
+// bestPosition searches around the nominal position for the frame start whose beginning
+// correlates best with the natural continuation of the previous frame.
+func (t *TimeStretcher) bestPosition() int {
+	nominal := int(t.nominal)
+	if t.prevPos < 0 {
+		return nominal
+	}
+	target := t.prevPos + t.hop
+	overlap := t.frame - t.hop
+	best, bestScore := nominal, math.Inf(-1)
+	for q := max(nominal-t.tolerance, t.inStart); q <= nominal+t.tolerance; q++ {
+		var corr, energy float64
+		for j := 0; j < overlap; j += 2 {
+			a, b := t.at(target+j), t.at(q+j)
+			x, y := a[0]+a[1], b[0]+b[1]
+			corr += x * y
+			energy += y * y
+		}
+		score := corr / math.Sqrt(energy+1e-9)
+		if score > bestScore {
+			best, bestScore = q, score
+		}
+	}
+	return best
+}
+
+// nextFrame adds one frame to the output and makes the next hop of samples ready. It returns
+// false once the source is exhausted and everything has been streamed.
+func (t *TimeStretcher) nextFrame() bool {
+	t.ready = t.ready[:0]
+	t.readyAt = 0
+	t.fill(int(t.nominal) + t.tolerance + t.frame)
+	if t.eof && int(t.nominal) >= t.inStart+len(t.in) {
+		if t.flushed || t.prevPos < 0 {
+			return false
+		}
+		// the second half of the last frame has no successor to overlap with
+		t.flushed = true
+		t.emit(t.frame - t.hop)
+		return true
+	}
+
+	pos := t.bestPosition()
+	for i := range t.acc {
+		s := t.at(pos + i)
+		w := t.window[i]
+		t.acc[i][0] += s[0] * w
+		t.acc[i][1] += s[1] * w
+		t.wsum[i] += w
+	}
+	t.emit(t.hop)
+	t.prevPos = pos
+	t.nominal += t.ratio * float64(t.hop)
+
+	// forget source samples that no later frame or search can reach
+	if drop := min(t.prevPos+t.hop, int(t.nominal)-t.tolerance) - t.inStart; drop > 0 {
+		drop = min(drop, len(t.in))
+		t.in = t.in[:copy(t.in, t.in[drop:])]
+		t.inStart += drop
+	}
+	return true
+}
+
+// emit normalizes the first n accumulated samples by the window sum, moves them to the ready
+// output and shifts the accumulator.
+func (t *TimeStretcher) emit(n int) {
+	for i := 0; i < n; i++ {
+		s := t.acc[i]
+		if w := t.wsum[i]; w > 1e-3 {
+			s[0] /= w
+			s[1] /= w
+		}
+		t.ready = append(t.ready, s)
+	}
+	copy(t.acc, t.acc[n:])
+	copy(t.wsum, t.wsum[n:])
+	clear(t.acc[len(t.acc)-n:])
+	clear(t.wsum[len(t.wsum)-n:])
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+func TestTimeStretcherReset(t *testing.T) {
+	// two seconds at one level, then two at another
+	f := beep.Format{SampleRate: testRate, NumChannels: 2, Precision: 2}
+	buffer := beep.NewBuffer(f)
+	level := func(v float64, n int) beep.Streamer {
+		return beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+			m := min(len(samples), n)
+			for i := range samples[:m] {
+				samples[i] = [2]float64{v, v}
+			}
+			n -= m
+			return m, m > 0
+		})
+	}
+	buffer.Append(level(1, 2000))
+	buffer.Append(level(0.5, 2000))
+	source := buffer.Streamer(0, buffer.Len())
+	stretcher := NewTimeStretcher(testRate, source)
+	stretcher.SetRatio(1.5)
+
+	out := make([][2]float64, 500)
+	stretcher.Stream(out)
+	if err := source.Seek(2500); err != nil {
+		t.Fatal(err)
+	}
+	stretcher.Reset()
+	n, _ := stretcher.Stream(out)
+	// nothing of the first level may play on after the jump
+	for i := range out[:n] {
+		if out[i][0] > 0.5+1e-9 {
+			t.Fatalf("sample %d after reset = %v, from before the seek", i, out[i][0])
+		}
+	}
+}
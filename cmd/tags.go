@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxTagSize limits how much of a file is read to find its tags.
+const maxTagSize = 1 << 20
+
+// trackNumber reads the track number tag of an MP3 (ID3v2 TRCK frame), FLAC, Ogg Vorbis or Opus
+// file (TRACKNUMBER comment). It returns 0 when there is none or the file cannot be read.
+func trackNumber(file string) int {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return 0
+	}
+	switch {
+	case string(head[:3]) == "ID3":
+		return id3TrackNumber(f, head)
+	case string(head[:4]) == "fLaC":
+		if _, err := f.Seek(4, io.SeekStart); err != nil {
+			return 0
+		}
+		return flacTrackNumber(f)
+	case string(head[:4]) == "OggS":
+		data, _ := io.ReadAll(io.LimitReader(io.MultiReader(bytes.NewReader(head), f), 64<<10))
+		for _, marker := range []string{"\x03vorbis", "OpusTags"} {
+			if i := bytes.Index(data, []byte(marker)); i >= 0 {
+				return vorbisCommentTrackNumber(data[i+len(marker):])
+			}
+		}
+	}
+	return 0
+}
+
+// id3TrackNumber finds the TRCK frame (TRK in ID3v2.2) of the tag starting with header.
+func id3TrackNumber(r io.Reader, header []byte) int {
+	version, flags := header[3], header[5]
+	size := syncsafe(header[6:10])
+	tag := make([]byte, min(size, maxTagSize))
+	n, _ := io.ReadFull(r, tag)
+	tag = tag[:n]
+	if flags&0x80 != 0 && version < 4 {
+		// unsynchronisation inserted a zero after every 0xff
+		tag = bytes.ReplaceAll(tag, []byte{0xff, 0x00}, []byte{0xff})
+	}
+	if flags&0x40 != 0 && len(tag) >= 4 {
+		// skip the extended header
+		extended := int(binary.BigEndian.Uint32(tag)) + 4
+		if version >= 4 {
+			extended = syncsafe(tag[:4])
+		}
+		tag = tag[min(extended, len(tag)):]
+	}
+	idLen, headerLen, id := 4, 10, "TRCK"
+	if version == 2 {
+		idLen, headerLen, id = 3, 6, "TRK"
+	}
+	for len(tag) >= headerLen && tag[0] != 0 {
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:8]))
+		default:
+			frameSize = syncsafe(tag[4:8])
+		}
+		body := tag[headerLen:]
+		if frameSize > len(body) {
+			return 0
+		}
+		if string(tag[:idLen]) == id {
+			return leadingNumber(body[:frameSize])
+		}
+		tag = body[frameSize:]
+	}
+	return 0
+}
+
+// flacTrackNumber walks the metadata blocks after the fLaC marker to the VORBIS_COMMENT block.
+func flacTrackNumber(r io.ReadSeeker) int {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0
+		}
+		last, kind := header[0]&0x80 != 0, header[0]&0x7f
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if kind == 4 {
+			block := make([]byte, min(length, maxTagSize))
+			n, _ := io.ReadFull(r, block)
+			return vorbisCommentTrackNumber(block[:n])
+		}
+		if last {
+			return 0
+		}
+		if _, err := r.Seek(int64(length), io.SeekCurrent); err != nil {
+			return 0
+		}
+	}
+}
+
+// vorbisCommentTrackNumber reads the TRACKNUMBER field of a Vorbis comment block: a vendor
+// string and a list of KEY=value strings, each preceded by its little-endian length.
+func vorbisCommentTrackNumber(b []byte) int {
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n > len(b)-4 {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+	if _, ok := next(); !ok {
+		return 0
+	}
+	if len(b) < 4 {
+		return 0
+	}
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return 0
+		}
+		key, value, _ := strings.Cut(comment, "=")
+		if strings.EqualFold(key, "TRACKNUMBER") {
+			return leadingNumber([]byte(value))
+		}
+	}
+	return 0
+}
+
+// leadingNumber parses the first number in b, e.g. 3 from "3/12". Text encoding bytes, byte order
+// marks and the zero bytes of UTF-16 before and inside the number are skipped.
+func leadingNumber(b []byte) int {
+	n, seen := 0, false
+	for _, c := range b {
+		switch {
+		case isDigit(c):
+			n = n*10 + int(c-'0')
+			seen = true
+			if n > 1e6 {
+				return 0
+			}
+		case c == 0 || !seen:
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
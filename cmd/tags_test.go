@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// id3v23 builds an ID3v2.3 tag with the given frames.
+func id3v23(frames map[string][]byte) []byte {
+	var body bytes.Buffer
+	for _, id := range []string{"TIT2", "TRCK"} {
+		data, ok := frames[id]
+		if !ok {
+			continue
+		}
+		body.WriteString(id)
+		binary.Write(&body, binary.BigEndian, uint32(len(data)))
+		body.Write([]byte{0, 0})
+		body.Write(data)
+	}
+	size := body.Len()
+	header := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body.Bytes()...)
+}
+
+func TestID3TrackNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames map[string][]byte
+		want   int
+	}{
+		{"latin1", map[string][]byte{"TIT2": []byte("\x00Song"), "TRCK": []byte("\x007")}, 7},
+		{"of total", map[string][]byte{"TRCK": []byte("\x0310/12")}, 10},
+		{"utf16", map[string][]byte{"TRCK": []byte("\x01\xff\xfe3\x00/\x001\x002\x00")}, 3},
+		{"none", map[string][]byte{"TIT2": []byte("\x00Song")}, 0},
+	}
+	for _, tt := range tests {
+		tag := id3v23(tt.frames)
+		if got := id3TrackNumber(bytes.NewReader(tag[10:]), tag[:10]); got != tt.want {
+			t.Errorf("%s: id3TrackNumber = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrackNumberFLAC(t *testing.T) {
+	var comments bytes.Buffer
+	field := func(s string) {
+		binary.Write(&comments, binary.LittleEndian, uint32(len(s)))
+		comments.WriteString(s)
+	}
+	field("vendor")
+	binary.Write(&comments, binary.LittleEndian, uint32(2))
+	field("TITLE=Song")
+	field("tracknumber=4/9")
+	var file bytes.Buffer
+	file.WriteString("fLaC")
+	// a STREAMINFO block to skip, then the last block with the comments
+	file.Write([]byte{0, 0, 0, 34})
+	file.Write(make([]byte, 34))
+	n := comments.Len()
+	file.Write([]byte{0x84, byte(n >> 16), byte(n >> 8), byte(n)})
+	file.Write(comments.Bytes())
+	path := filepath.Join(t.TempDir(), "a.flac")
+	if err := os.WriteFile(path, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := trackNumber(path); got != 4 {
+		t.Errorf("trackNumber = %d, want 4", got)
+	}
+}
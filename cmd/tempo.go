@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ticksPerBeat is the resolution of the tick part of bars:beats:ticks positions.
+const ticksPerBeat = 480
+
+// tempoGrid maps session samples to bars and beats. Bar 1 beat 1 starts at Offset.
+type tempoGrid struct {
+	BPM    float64
+	Beats  int // beats per bar, the numerator of the time signature
+	Unit   int // note value of a beat, the denominator of the time signature
+	Offset int // sample position of the first downbeat
+}
+
+// tempo is the grid of the loaded session, nil while no tempo is set.
+var tempo *tempoGrid
+
+func (g *tempoGrid) samplesPerBeat() float64 {
+	return float64(ap.sampleRate) * 60 / g.BPM
+}
+
+// barsBeats converts a sample position into 1-based bar and beat numbers and ticks. Positions
+// before the first downbeat count backwards from bar 0.
+func (g *tempoGrid) barsBeats(pos int) (bar, beat, tick int) {
+	totalTicks := int(math.Floor(float64(pos-g.Offset) / g.samplesPerBeat() * ticksPerBeat))
+	beats := floorDiv(totalTicks, ticksPerBeat)
+	tick = totalTicks - beats*ticksPerBeat
+	bars := floorDiv(beats, g.Beats)
+	return bars + 1, beats - bars*g.Beats + 1, tick
+}
+
+// sample converts 1-based bar and beat numbers and ticks into a sample position.
+func (g *tempoGrid) sample(bar, beat, tick int) int {
+	beats := float64((bar-1)*g.Beats+beat-1) + float64(tick)/ticksPerBeat
+	return g.Offset + int(math.Round(beats*g.samplesPerBeat()))
+}
+
+func (g *tempoGrid) format(pos int) string {
+	bar, beat, tick := g.barsBeats(pos)
+	return fmt.Sprintf("%d:%d:%03d", bar, beat, tick)
+}
+
+func (g *tempoGrid) String() string {
+	return fmt.Sprintf("%g BPM in %d/%d, bar 1 at %s", g.BPM, g.Beats, g.Unit, formatClock(ap.sampleRate.D(g.Offset).Seconds()))
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// isBarPosition reports whether arg is written in bar units, e.g. "b17" or "b17:3:240".
+func isBarPosition(arg string) bool {
+	return len(arg) > 1 && arg[0] == 'b' && arg[1] >= '0' && arg[1] <= '9'
+}
+
+// parseBarPosition parses "b<bar>[:<beat>[:<tick>]]" into a sample position on the tempo grid.
+func parseBarPosition(arg string) (int, error) {
+	if tempo == nil {
+		return 0, fmt.Errorf("bar positions need a tempo, set one with: tempo <bpm>")
+	}
+	parts := strings.Split(arg[1:], ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid bar position %q (use e.g. b17, b17:3 or b17:3:240)", arg)
+	}
+	values := []int{1, 1, 0}
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid bar position %q (use e.g. b17, b17:3 or b17:3:240)", arg)
+		}
+		values[i] = v
+	}
+	bar, beat, tick := values[0], values[1], values[2]
+	if beat < 1 || beat > tempo.Beats || tick < 0 || tick >= ticksPerBeat {
+		return 0, fmt.Errorf("bar position %q is outside of a %d/%d bar", arg, tempo.Beats, tempo.Unit)
+	}
+	return tempo.sample(bar, beat, tick), nil
+}
+
+// parseTimeSignature parses "4/4", "6/8" and the like.
+func parseTimeSignature(arg string) (beats, unit int, err error) {
+	num, den, ok := strings.Cut(arg, "/")
+	if ok {
+		beats, err = strconv.Atoi(num)
+		if err == nil {
+			unit, err = strconv.Atoi(den)
+		}
+	}
+	if !ok || err != nil || beats < 1 || unit < 1 || unit&(unit-1) != 0 {
+		return 0, 0, fmt.Errorf("invalid time signature %q (use e.g. 4/4 or 6/8)", arg)
+	}
+	return beats, unit, nil
+}
+
+// clickTrack is a metronome generated from the tempo grid, with accented downbeats. It spans
+// the other tracks of its session so it never makes the session longer.
+type clickTrack struct {
+	mts *MultiTrackSeeker
+	pos int
+}
+
+const (
+	clickDuration = 0.03 // seconds
+	clickDecay    = 0.006
+)
+
+func (c *clickTrack) Stream(samples [][2]float64) (n int, ok bool) {
+	length := c.Len()
+	if c.pos >= length {
+		return 0, false
+	}
+	samples = samples[:min(len(samples), length-c.pos)]
+	clear(samples)
+	if tempo != nil {
+		rate := float64(ap.sampleRate)
+		spb := tempo.samplesPerBeat()
+		for i := range samples {
+			rel := float64(c.pos+i-tempo.Offset) / spb
+			if rel < 0 {
+				continue
+			}
+			beat := math.Floor(rel)
+			t := (rel - beat) * spb / rate
+			if t >= clickDuration {
+				continue
+			}
+			freq, amp := 1000.0, 0.4
+			if int(beat)%tempo.Beats == 0 {
+				freq, amp = 1600.0, 0.7
+			}
+			v := amp * math.Sin(2*math.Pi*freq*t) * math.Exp(-t/clickDecay)
+			samples[i] = [2]float64{v, v}
+		}
+	}
+	c.pos += len(samples)
+	return len(samples), true
+}
+
+func (c *clickTrack) Err() error {
+	return nil
+}
+
+func (c *clickTrack) Len() int {
+	length := 0
+	for _, t := range c.mts.Tracks {
+		if !t.Generated {
+			length = max(length, t.Streamer.Len())
+		}
+	}
+	return length
+}
+
+func (c *clickTrack) Position() int {
+	return c.pos
+}
+
+func (c *clickTrack) Seek(p int) error {
+	c.pos = p
+	return nil
+}
+
+// clickTrackOf returns the click track of the session, or nil.
+func clickTrackOf(mts *MultiTrackSeeker) *Track {
+	for i := range mts.Tracks {
+		if _, ok := mts.Tracks[i].Streamer.(*clickTrack); ok {
+			return &mts.Tracks[i]
+		}
+	}
+	return nil
+}
+
+// setTempo installs a tempo grid and makes sure the session has a click track for it. A new
+// click track starts muted. It must be called with the output locked.
+func setTempo(mts *MultiTrackSeeker, g *tempoGrid) *Track {
+	tempo = g
+	if t := clickTrackOf(mts); t != nil {
+		return t
+	}
+	click := &clickTrack{mts: mts, pos: mts.Position()}
+	t := mts.AddGeneratedTrack(click, "click")
+	t.Mute = true
+	return t
+}
+
+// clearTempo removes the tempo grid and the click track. It must be called with the output locked.
+func clearTempo(mts *MultiTrackSeeker) {
+	tempo = nil
+	if t := clickTrackOf(mts); t != nil {
+		for i := range mts.Tracks {
+			if &mts.Tracks[i] == t {
+				mts.RemoveTrack(i)
+				break
+			}
+		}
+	}
+}
+
+var tempoCmd = &cobra.Command{
+	Use:   "tempo [bpm] [timesig] [offset] | tempo off",
+	Short: "Set a tempo grid (e.g. tempo 96 4/4 0:01.250) for bar positions and the click track",
+	Long: `Define a tempo grid over the session: beats per minute, an optional time signature (default
+4/4) and an optional offset of the first downbeat, given as a time like 0:01.250, 1.25s or a marker.
+With a grid, pos shows bars:beats:ticks and goto, setmarker --at, loop, save and render accept bar
+positions like b17 or b17:3 (bar 17, beat 3). A click track with accented downbeats is added to the
+session, muted; unmute it like any other track. Without arguments the grid is shown, "tempo off"
+removes it.`,
+	Args: cobra.RangeArgs(0, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		mts := requireMultiTrack()
+		if mts == nil {
+			return
+		}
+		if len(args) == 0 {
+			if tempo == nil {
+				fmt.Println("No tempo set")
+				return
+			}
+			fmt.Printf("Tempo: %s\n", tempo)
+			return
+		}
+		if args[0] == "off" {
+			output.Lock()
+			clearTempo(mts)
+			mixChanged()
+			output.Unlock()
+			fmt.Println("Tempo grid and click track removed")
+			return
+		}
+		bpm, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || math.IsNaN(bpm) || bpm <= 0 || bpm > 1000 {
+			fmt.Printf("Invalid tempo %q\n", args[0])
+			return
+		}
+		g := &tempoGrid{BPM: bpm, Beats: 4, Unit: 4}
+		if len(args) > 1 {
+			if g.Beats, g.Unit, err = parseTimeSignature(args[1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		if len(args) > 2 {
+			if g.Offset, _, err = parsePosition(args[2], 0); err != nil {
+				fmt.Printf("Failed to parse offset: %s\n", err)
+				return
+			}
+		}
+		output.Lock()
+		click := setTempo(mts, g)
+		mixChanged()
+		state := "muted"
+		if !click.Mute {
+			state = "audible"
+		}
+		output.Unlock()
+		fmt.Printf("Tempo set to %s\n", g)
+		fmt.Printf("Click track is track %d (%s)\n", click.TrackNumber, state)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(tempoCmd)
+}
@@ -0,0 +1,14 @@
+package cmd
+
+import "testing"
+
+func TestTempoCommand(t *testing.T) {
+	newTestSession(t, 1)
+	execute(t, "tempo", "120")
+	for _, value := range []string{"NaN", "Inf", "0", "1001"} {
+		execute(t, "tempo", value)
+		if tempo == nil || tempo.BPM != 120 {
+			t.Errorf("tempo %s: grid %+v, want it left at 120 BPM", value, tempo)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// speedTrainer raises the playback speed by a step every reps passes of the loop until the
+// target speed is reached. Speeds are multipliers, 1 is the original tempo.
+type speedTrainer struct {
+	from, to, step float64
+	reps           int
+	passes         int // passes at the current speed
+	total          int // passes since the trainer started
+	speed          float64
+}
+
+var trainer *speedTrainer
+
+// wrap is called by the loop each time it jumps back to its start, while the output is
+// streaming. The audio chain must not be retuned from inside its own Stream call, so the new
+// speed is applied from a separate goroutine once the output lock is free again.
+func (tr *speedTrainer) wrap() {
+	tr.total++
+	tr.passes++
+	changed := false
+	if tr.passes >= tr.reps {
+		tr.passes = 0
+		if tr.step > 0 {
+			tr.speed = min(tr.speed+tr.step, tr.to)
+		} else {
+			tr.speed = max(tr.speed+tr.step, tr.to)
+		}
+		changed = true
+	}
+	speed, pass, done := tr.speed, tr.total, tr.speed == tr.to
+	if done {
+		ap.loop.onWrap = nil
+	}
+	go func() {
+		output.Lock()
+		if trainer != tr {
+			// stopped or replaced in the meantime
+			output.Unlock()
+			return
+		}
+		if changed {
+			ap.setSpeed(speed)
+		}
+		if done {
+			trainer = nil
+		}
+		output.Unlock()
+		fmt.Printf("Pass %d: speed %.0f%%\n", pass, speed*100)
+		if done {
+			fmt.Println("Target speed reached, trainer finished")
+		}
+	}()
+}
+
+func (tr *speedTrainer) status() string {
+	return fmt.Sprintf("Speed trainer: %.0f%% of %.0f%% (from %.0f%%, step %+.0f%% every %d passes)",
+		tr.speed*100, tr.to*100, tr.from*100, tr.step*100, tr.reps)
+}
+
+// stopTrainer detaches the running speed trainer, if any. It must be called with the output locked.
+func stopTrainer() bool {
+	if trainer == nil {
+		return false
+	}
+	trainer = nil
+	if ap != nil {
+		ap.loop.onWrap = nil
+	}
+	return true
+}
+
+// parsePercent accepts "60" or "60%" and returns a multiplier like 0.6. NaN and infinities are
+// rejected.
+func parsePercent(arg string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(arg, "%"), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid percentage %q", arg)
+	}
+	return v / 100, nil
+}
+
+var trainerCmd = &cobra.Command{
+	Use:   "trainer <start%> <end%> <step%> [reps] | trainer off",
+	Short: "Drill the loop, raising the speed by step% every reps passes from start% to end%",
+	Long: `Start a speed trainer on the current loop: playback jumps to the loop start at start% speed
+and every reps passes (default 1) the speed changes by step% until end% is reached, e.g.
+"trainer 60 100 5 2" goes from 60% to 100% in steps of 5%, playing each speed twice. The speed is
+printed at every step. "trainer off" stops it, and so does setting the speed by hand.`,
+	Args: cobra.RangeArgs(1, 4),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireAudioLoaded() {
+			return
+		}
+		if len(args) == 1 {
+			if args[0] != "off" {
+				fmt.Println("Expected start%, end% and step%, or off")
+				return
+			}
+			output.Lock()
+			stopped := stopTrainer()
+			output.Unlock()
+			if stopped {
+				fmt.Println("Speed trainer stopped")
+			} else {
+				fmt.Println("No speed trainer running")
+			}
+			return
+		}
+		if len(args) < 3 {
+			fmt.Println("Expected start%, end% and step%")
+			return
+		}
+		var values [3]float64
+		for i, arg := range args[:3] {
+			v, err := parsePercent(arg)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			values[i] = v
+		}
+		from, to, step := values[0], values[1], values[2]
+		if from <= 0 || to <= 0 || step <= 0 {
+			fmt.Println("Speeds and step must be greater than 0%")
+			return
+		}
+		if to < from {
+			step = -step
+		}
+		reps := 1
+		if len(args) > 3 {
+			var err error
+			reps, err = strconv.Atoi(args[3])
+			if err != nil || reps < 1 {
+				fmt.Printf("Invalid number of passes %q\n", args[3])
+				return
+			}
+		}
+		tr := &speedTrainer{from: from, to: to, step: step, reps: reps, speed: from}
+		output.Lock()
+		stopTrainer()
+		trainer = tr
+		ap.setSpeed(from)
+		ap.loop.onWrap = tr.wrap
+		err := ap.seek(ap.loop.start)
+		output.Unlock()
+		if err != nil {
+			fmt.Printf("Failed to seek to loop start: %s\n", err)
+			return
+		}
+		fmt.Println(tr.status())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(trainerCmd)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import "testing"
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want float64
+		err  bool
+	}{
+		{"60", 0.6, false},
+		{"105%", 1.05, false},
+		{"nan", 0, true},
+		{"inf", 0, true},
+		{"-Inf%", 0, true},
+		{"fast", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePercent(tt.arg)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parsePercent(%q) = %v, %v; want %v, error %v", tt.arg, got, err, tt.want, tt.err)
+		}
+	}
+}
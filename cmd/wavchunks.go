@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// wavChunk encodes a RIFF chunk, padded to an even size.
+func wavChunk(id string, body []byte) []byte {
+	chunk := make([]byte, 0, 8+len(body)+1)
+	chunk = append(chunk, id...)
+	chunk = binary.LittleEndian.AppendUint32(chunk, uint32(len(body)))
+	chunk = append(chunk, body...)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// wavMarkerChunks builds "cue ", "LIST"/"adtl" and "smpl" chunks for the markers and the loop
+// region that fall inside [start, end) of the session. Positions are rebased to start and
+// multiplied by scale to convert session samples to samples of the exported file.
+func wavMarkerChunks(start, end int, scale float64, sampleRate int) [][]byte {
+	toFile := func(pos int) uint32 {
+		return uint32(float64(pos-start)*scale + 0.5)
+	}
+	type cuePoint struct {
+		id     uint32
+		pos    int
+		length int
+		label  string
+	}
+	var cues []cuePoint
+	for _, m := range Markers {
+		if !m.Set || m.SamplePosition < start || m.SamplePosition >= end {
+			continue
+		}
+		c := cuePoint{id: uint32(len(cues) + 1), pos: m.SamplePosition, label: m.Label}
+		if m.IsRegion() {
+			c.length = min(m.EndPosition, end) - m.SamplePosition
+		}
+		cues = append(cues, c)
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].pos < cues[j].pos })
+
+	var chunks [][]byte
+	if len(cues) > 0 {
+		cueBody := binary.LittleEndian.AppendUint32(nil, uint32(len(cues)))
+		var adtl []byte
+		adtl = append(adtl, "adtl"...)
+		for _, c := range cues {
+			cueBody = binary.LittleEndian.AppendUint32(cueBody, c.id)
+			cueBody = binary.LittleEndian.AppendUint32(cueBody, toFile(c.pos))
+			cueBody = append(cueBody, "data"...)
+			cueBody = binary.LittleEndian.AppendUint32(cueBody, 0) // chunk start
+			cueBody = binary.LittleEndian.AppendUint32(cueBody, 0) // block start
+			cueBody = binary.LittleEndian.AppendUint32(cueBody, toFile(c.pos))
+			if c.label != "" {
+				labl := binary.LittleEndian.AppendUint32(nil, c.id)
+				labl = append(append(labl, c.label...), 0)
+				adtl = append(adtl, wavChunk("labl", labl)...)
+			}
+			if c.length > 0 {
+				ltxt := binary.LittleEndian.AppendUint32(nil, c.id)
+				ltxt = binary.LittleEndian.AppendUint32(ltxt, uint32(float64(c.length)*scale+0.5))
+				ltxt = append(ltxt, "rgn "...)
+				ltxt = append(ltxt, make([]byte, 8)...) // country, language, dialect, code page
+				adtl = append(adtl, wavChunk("ltxt", ltxt)...)
+			}
+		}
+		chunks = append(chunks, wavChunk("cue ", cueBody))
+		if len(adtl) > 4 {
+			chunks = append(chunks, wavChunk("LIST", adtl))
+		}
+	}
+
+	// Only an explicit loop is exported, not the default loop over the whole session.
+	loopStart, loopEnd := max(ap.loop.start, start), min(ap.loop.end, end)
+	if (ap.loop.start != 0 || ap.loop.end != ap.streamer.Len()) && loopStart < loopEnd {
+		smpl := make([]byte, 0, 60)
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // manufacturer
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // product
+		smpl = binary.LittleEndian.AppendUint32(smpl, uint32(1e9/sampleRate)) // sample period in ns
+		smpl = binary.LittleEndian.AppendUint32(smpl, 60)                     // MIDI unity note
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // pitch fraction
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // SMPTE format
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // SMPTE offset
+		smpl = binary.LittleEndian.AppendUint32(smpl, 1)                      // number of loops
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // sampler data
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // cue point id
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // forward loop
+		smpl = binary.LittleEndian.AppendUint32(smpl, toFile(loopStart))      // start
+		smpl = binary.LittleEndian.AppendUint32(smpl, toFile(loopEnd)-1)      // end (inclusive)
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // fraction
+		smpl = binary.LittleEndian.AppendUint32(smpl, 0)                      // play count, 0 is infinite
+		chunks = append(chunks, wavChunk("smpl", smpl))
+	}
+	return chunks
+}
+
+// wavMarkers holds the markers and loop read back from a WAV file, in seconds.
+type wavMarkers struct {
+	Markers []labelEntry
+	Loop    *labelEntry
+}
+
+// readWAVMarkers reads the cue points, their labels and region lengths, and the first sampler
+// loop of a WAV file. Other chunks are skipped without reading them, and a chunk that claims to
+// be larger than the rest of the file ends the search.
+func readWAVMarkers(path string) (wavMarkers, error) {
+	var result wavMarkers
+	f, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return result, err
+	}
+
+	var riff [12]byte
+	if _, err := io.ReadFull(f, riff[:]); err != nil {
+		return result, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return result, fmt.Errorf("%s is not a WAV file", path)
+	}
+
+	sampleRate := 0
+	positions := map[uint32]uint32{}
+	labels := map[uint32]string{}
+	lengths := map[uint32]uint32{}
+	var order []uint32
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(f, header[:]); err != nil {
+			break
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		padded := size + size%2
+		switch id {
+		case "fmt ", "cue ", "LIST", "smpl":
+		default:
+			if _, err := f.Seek(padded, io.SeekCurrent); err != nil {
+				return result, err
+			}
+			continue
+		}
+		at, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return result, err
+		}
+		if size > info.Size()-at {
+			break
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(f, body); err != nil {
+			break
+		}
+		if size%2 == 1 {
+			f.Seek(1, io.SeekCurrent)
+		}
+		switch id {
+		case "fmt ":
+			if len(body) >= 8 {
+				sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			}
+		case "cue ":
+			if len(body) < 4 {
+				continue
+			}
+			n := int(binary.LittleEndian.Uint32(body[0:4]))
+			for i := 0; i < n && 4+(i+1)*24 <= len(body); i++ {
+				point := body[4+i*24:]
+				cueID := binary.LittleEndian.Uint32(point[0:4])
+				positions[cueID] = binary.LittleEndian.Uint32(point[20:24])
+				order = append(order, cueID)
+			}
+		case "LIST":
+			if len(body) < 4 || string(body[0:4]) != "adtl" {
+				continue
+			}
+			for sub := body[4:]; len(sub) >= 8; {
+				subID := string(sub[0:4])
+				subSize := int(binary.LittleEndian.Uint32(sub[4:8]))
+				if 8+subSize > len(sub) {
+					break
+				}
+				data := sub[8 : 8+subSize]
+				switch {
+				case (subID == "labl" || subID == "note") && len(data) >= 4:
+					cueID := binary.LittleEndian.Uint32(data[0:4])
+					if _, ok := labels[cueID]; !ok || subID == "labl" {
+						labels[cueID] = strings.TrimRight(string(data[4:]), "\x00")
+					}
+				case subID == "ltxt" && len(data) >= 8:
+					lengths[binary.LittleEndian.Uint32(data[0:4])] = binary.LittleEndian.Uint32(data[4:8])
+				}
+				sub = sub[min(8+subSize+subSize%2, len(sub)):]
+			}
+		case "smpl":
+			if len(body) >= 36+24 && binary.LittleEndian.Uint32(body[28:32]) > 0 {
+				loop := body[36:]
+				result.Loop = &labelEntry{
+					Start: float64(binary.LittleEndian.Uint32(loop[8:12])),
+					End:   float64(binary.LittleEndian.Uint32(loop[12:16]) + 1),
+				}
+			}
+		}
+	}
+	if sampleRate == 0 {
+		return result, fmt.Errorf("%s has no fmt chunk", path)
+	}
+
+	seconds := func(samples uint32) float64 {
+		return float64(samples) / float64(sampleRate)
+	}
+	for _, cueID := range order {
+		pos := positions[cueID]
+		entry := labelEntry{Start: seconds(pos), End: seconds(pos), Label: labels[cueID]}
+		if length, ok := lengths[cueID]; ok && length > 0 {
+			entry.End = seconds(pos + length)
+		}
+		result.Markers = append(result.Markers, entry)
+	}
+	if result.Loop != nil {
+		result.Loop.Start /= float64(sampleRate)
+		result.Loop.End /= float64(sampleRate)
+	}
+	return result, nil
+}
+
+// collectWAVMarkers adds the markers embedded in a WAV file loaded at offset seconds to m. Only
+// the first loop found is kept.
+func collectWAVMarkers(m *wavMarkers, file string, offset float64) {
+	found, err := readWAVMarkers(file)
+	if err != nil {
+		fmt.Printf("Failed to read markers from %s: %s\n", file, err)
+		return
+	}
+	for _, e := range found.Markers {
+		e.Start += offset
+		e.End += offset
+		m.Markers = append(m.Markers, e)
+	}
+	if found.Loop != nil && m.Loop == nil {
+		m.Loop = &labelEntry{Start: found.Loop.Start + offset, End: found.Loop.End + offset}
+	}
+}
+
+// applyWAVMarkers imports markers read from loaded WAV files. The embedded loop only replaces
+// the loop region of a session that was just created, never one the user already set.
+func applyWAVMarkers(m wavMarkers, newSession bool) {
+	if ap == nil {
+		return
+	}
+	if len(m.Markers) > 0 {
+		fmt.Printf("Imported %d markers embedded in the WAV files\n", importLabels(m.Markers))
+	}
+	if m.Loop == nil || !newSession {
+		return
+	}
+	start := ap.sampleRate.N(time.Duration(m.Loop.Start * float64(time.Second)))
+	end := min(ap.sampleRate.N(time.Duration(m.Loop.End*float64(time.Second))), ap.streamer.Len())
+	if start < 0 || start >= end {
+		return
+	}
+	output.Lock()
+	ap.loop.start = start
+	ap.loop.end = end
+	output.Unlock()
+	fmt.Printf("Loop set from the embedded sampler loop: %.2f to %.2f sec\n", m.Loop.Start, m.Loop.End)
+}
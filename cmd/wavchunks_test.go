@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+func TestWAVMarkersRoundTrip(t *testing.T) {
+	newTestSession(t, 10)
+	Markers[1] = newMarker(1000, "intro")
+	Markers[2] = newMarker(2000, "verse")
+	Markers[2].EndPosition = 3500
+	Markers[3] = newMarker(9000, "")
+	ap.loop.start, ap.loop.end = 4000, 6000
+
+	tests := []struct {
+		name        string
+		start, end  int
+		rate        int
+		wantMarkers []labelEntry
+		wantLoop    *labelEntry
+	}{
+		{
+			name: "whole session", start: 0, end: 10000, rate: 1000,
+			wantMarkers: []labelEntry{
+				{Start: 0, End: 0, Label: "start"},
+				{Start: 1, End: 1, Label: "intro"},
+				{Start: 2, End: 3.5, Label: "verse"},
+				{Start: 9, End: 9},
+				{Start: 9.999, End: 9.999, Label: "end"},
+			},
+			wantLoop: &labelEntry{Start: 4, End: 6},
+		},
+		{
+			name: "segment resampled", start: 500, end: 5000, rate: 2000,
+			wantMarkers: []labelEntry{
+				{Start: 0.5, End: 0.5, Label: "intro"},
+				{Start: 1.5, End: 3, Label: "verse"},
+			},
+			wantLoop: &labelEntry{Start: 3.5, End: 4.5},
+		},
+		{
+			name: "region cut at the end", start: 1500, end: 3000, rate: 1000,
+			wantMarkers: []labelEntry{
+				{Start: 0.5, End: 1.5, Label: "verse"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		scale := float64(tt.rate) / float64(testRate)
+		chunks := wavMarkerChunks(tt.start, tt.end, scale, tt.rate)
+		buffer := beep.NewBuffer(format)
+		buffer.Append(beep.Silence(tt.end - tt.start))
+		path := filepath.Join(t.TempDir(), "out.wav")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = encodeWAV(f, buffer.Streamer(0, buffer.Len()), testRate, wavOptions{SampleRate: tt.rate, BitDepth: 16}, chunks...)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readWAVMarkers(path)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if len(got.Markers) != len(tt.wantMarkers) {
+			t.Errorf("%s: markers %+v, want %+v", tt.name, got.Markers, tt.wantMarkers)
+			continue
+		}
+		for i, want := range tt.wantMarkers {
+			if !sameEntry(got.Markers[i], want) {
+				t.Errorf("%s: marker %d = %+v, want %+v", tt.name, i, got.Markers[i], want)
+			}
+		}
+		if (got.Loop == nil) != (tt.wantLoop == nil) || got.Loop != nil && !sameEntry(*got.Loop, *tt.wantLoop) {
+			t.Errorf("%s: loop %+v, want %+v", tt.name, got.Loop, tt.wantLoop)
+		}
+	}
+}
+
+func sameEntry(a, b labelEntry) bool {
+	return a.Label == b.Label && math.Abs(a.Start-b.Start) < 1e-9 && math.Abs(a.End-b.End) < 1e-9
+}
+
+func TestWAVMarkersOversizedChunk(t *testing.T) {
+	le := binary.LittleEndian
+	chunk := func(id string, body []byte, size uint32) []byte {
+		b := append([]byte(id), le.AppendUint32(nil, size)...)
+		return append(b, body...)
+	}
+	fmtBody := le.AppendUint16(nil, 1)
+	fmtBody = le.AppendUint16(fmtBody, 2)
+	fmtBody = le.AppendUint32(fmtBody, 1000)
+	fmtBody = le.AppendUint32(fmtBody, 4000)
+	fmtBody = le.AppendUint16(fmtBody, 4)
+	fmtBody = le.AppendUint16(fmtBody, 16)
+	cueBody := le.AppendUint32(nil, 1)
+	cueBody = append(cueBody, make([]byte, 24)...)
+	le.PutUint32(cueBody[4:], 1)
+	le.PutUint32(cueBody[24:], 500)
+
+	data := []byte("RIFF\xff\xff\xff\xffWAVE")
+	data = append(data, chunk("fmt ", fmtBody, uint32(len(fmtBody)))...)
+	data = append(data, chunk("cue ", cueBody, uint32(len(cueBody)))...)
+	data = append(data, chunk("junk", nil, 0xfffffff0)...)
+	data = append(data, chunk("LIST", []byte("adtl"), 0xfffffff0)...)
+	path := filepath.Join(t.TempDir(), "hostile.wav")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	got, err := readWAVMarkers(path)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Markers) != 1 || !sameEntry(got.Markers[0], labelEntry{Start: 0.5, End: 0.5}) {
+		t.Errorf("markers %+v, want the cue point at 0.5s", got.Markers)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("%d bytes allocated for a %d byte file", allocated, len(data))
+	}
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/spf13/pflag"
+)
+
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+)
+
+// wavOptions describes the sample format of an exported WAV file. Zero values keep the
+// properties of the source.
+type wavOptions struct {
+	SampleRate int  // target sample rate, resampled if it differs from the source
+	BitDepth   int  // 16, 24 or 32
+	Float      bool // 32-bit IEEE float instead of integer samples
+	Mono       bool // fold both channels down to one
+	Dither     bool // add TPDF dither before quantizing to integers
+}
+
+func addWAVFlags(flags *pflag.FlagSet, opts *wavOptions) {
+	flags.IntVar(&opts.BitDepth, "bits", 0, "bit depth of integer samples: 16, 24 or 32 (default: source precision)")
+	flags.BoolVar(&opts.Float, "float", false, "write 32-bit float samples")
+	flags.BoolVar(&opts.Mono, "mono", false, "fold down to a single channel")
+	flags.IntVar(&opts.SampleRate, "rate", 0, "resample to this sample rate, e.g. 48000 (default: source rate)")
+	flags.BoolVar(&opts.Dither, "dither", false, "apply TPDF dither when quantizing to integer samples")
+}
+
+// resolve fills in defaults from the source format and validates the options.
+func (o wavOptions) resolve(source beep.Format) (wavOptions, error) {
+	if o.SampleRate == 0 {
+		o.SampleRate = int(source.SampleRate)
+	}
+	if o.SampleRate < 0 {
+		return o, fmt.Errorf("invalid sample rate %d", o.SampleRate)
+	}
+	if o.Float {
+		if o.BitDepth != 0 && o.BitDepth != 32 {
+			return o, fmt.Errorf("float samples are always 32-bit")
+		}
+		o.BitDepth = 32
+		return o, nil
+	}
+	if o.BitDepth == 0 {
+		o.BitDepth = source.Precision * 8
+		if o.BitDepth < 16 {
+			o.BitDepth = 16
+		}
+	}
+	switch o.BitDepth {
+	case 16, 24, 32:
+	default:
+		return o, fmt.Errorf("unsupported bit depth %d (use 16, 24 or 32)", o.BitDepth)
+	}
+	return o, nil
+}
+
+func (o wavOptions) channels() int {
+	if o.Mono {
+		return 1
+	}
+	return 2
+}
+
+func (o wavOptions) formatTag() uint16 {
+	if o.Float {
+		return wavFormatFloat
+	}
+	return wavFormatPCM
+}
+
+// describe summarizes the options for messages, e.g. "48000 Hz 24-bit mono".
+func (o wavOptions) describe() string {
+	kind := fmt.Sprintf("%d-bit", o.BitDepth)
+	if o.Float {
+		kind = "32-bit float"
+	}
+	layout := "stereo"
+	if o.Mono {
+		layout = "mono"
+	}
+	return fmt.Sprintf("%d Hz %s %s", o.SampleRate, kind, layout)
+}
+
+// wavSampleWriter converts float samples to the chosen WAV sample format.
+type wavSampleWriter struct {
+	opts wavOptions
+	rng  *rand.Rand
+	buf  []byte
+}
+
+func (sw *wavSampleWriter) put(v float64) {
+	if sw.opts.Float {
+		sw.buf = binary.LittleEndian.AppendUint32(sw.buf, math.Float32bits(float32(v)))
+		return
+	}
+	full := float64(int64(1) << (sw.opts.BitDepth - 1))
+	v *= full
+	if sw.opts.Dither {
+		// triangular PDF noise spanning +-1 LSB
+		v += sw.rng.Float64() - sw.rng.Float64()
+	}
+	q := int64(math.Round(v))
+	q = max(min(q, int64(full)-1), -int64(full))
+	switch sw.opts.BitDepth {
+	case 16:
+		sw.buf = binary.LittleEndian.AppendUint16(sw.buf, uint16(q))
+	case 24:
+		sw.buf = append(sw.buf, byte(q), byte(q>>8), byte(q>>16))
+	case 32:
+		sw.buf = binary.LittleEndian.AppendUint32(sw.buf, uint32(q))
+	}
+}
+
+// encodeWAV writes s, produced at sourceRate, as a WAV file with the given options. Extra chunks,
+// already encoded with wavChunk, are appended after the sample data.
+func encodeWAV(w io.WriteSeeker, s beep.Streamer, sourceRate beep.SampleRate, opts wavOptions, extra ...[]byte) error {
+	if beep.SampleRate(opts.SampleRate) != sourceRate {
+		s = beep.Resample(6, sourceRate, beep.SampleRate(opts.SampleRate), s)
+	}
+	channels := opts.channels()
+	blockAlign := channels * opts.BitDepth / 8
+
+	header := make([]byte, 0, 64)
+	header = append(header, "RIFF\x00\x00\x00\x00WAVE"...)
+	header = append(header, "fmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, opts.formatTag())
+	header = binary.LittleEndian.AppendUint16(header, uint16(channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(opts.SampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(opts.SampleRate*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(opts.BitDepth))
+	factOffset := -1
+	if opts.Float {
+		// non-PCM formats carry the frame count in a fact chunk
+		header = append(header, "fact"...)
+		header = binary.LittleEndian.AppendUint32(header, 4)
+		factOffset = len(header)
+		header = binary.LittleEndian.AppendUint32(header, 0)
+	}
+	header = append(header, "data\x00\x00\x00\x00"...)
+	dataOffset := len(header)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	sw := &wavSampleWriter{opts: opts, rng: rand.New(rand.NewSource(1))}
+	samples := make([][2]float64, 4096)
+	frames := 0
+	for {
+		n, ok := s.Stream(samples)
+		sw.buf = sw.buf[:0]
+		for _, sample := range samples[:n] {
+			if opts.Mono {
+				sw.put((sample[0] + sample[1]) / 2)
+			} else {
+				sw.put(sample[0])
+				sw.put(sample[1])
+			}
+		}
+		if _, err := w.Write(sw.buf); err != nil {
+			return err
+		}
+		frames += n
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	dataSize := frames * blockAlign
+	riffSize := dataOffset - 8 + dataSize
+	if dataSize%2 == 1 {
+		// chunks are word aligned
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+		riffSize++
+	}
+	for _, chunk := range extra {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		riffSize += len(chunk)
+	}
+
+	patch := func(offset int, v int) error {
+		if _, err := w.Seek(int64(offset), io.SeekStart); err != nil {
+			return err
+		}
+		return binary.Write(w, binary.LittleEndian, uint32(v))
+	}
+	if err := patch(4, riffSize); err != nil {
+		return err
+	}
+	if factOffset >= 0 {
+		if err := patch(factOffset, frames); err != nil {
+			return err
+		}
+	}
+	if err := patch(dataOffset-4, dataSize); err != nil {
+		return err
+	}
+	_, err := w.Seek(0, io.SeekEnd)
+	return err
+}